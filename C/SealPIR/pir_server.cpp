@@ -26,6 +26,46 @@ void PIRServer::preprocess_database() {
     }
 }
 
+string PIRServer::serialize_database() {
+    if (!db_) {
+        throw logic_error("db is not set");
+    }
+
+    std::ostringstream output;
+    uint8_t preprocessed = is_db_preprocessed_ ? 1 : 0;
+    uint64_t size = db_->size();
+    output.write(reinterpret_cast<const char *>(&preprocessed), sizeof(preprocessed));
+    output.write(reinterpret_cast<const char *>(&size), sizeof(size));
+
+    for (uint64_t i = 0; i < size; i++) {
+        db_->operator[](i).save(output);
+    }
+
+    return output.str();
+}
+
+void PIRServer::load_database(const string &serialized) {
+    std::istringstream input(serialized);
+    uint8_t preprocessed;
+    uint64_t size;
+    input.read(reinterpret_cast<char *>(&preprocessed), sizeof(preprocessed));
+    input.read(reinterpret_cast<char *>(&size), sizeof(size));
+    if (!input) {
+        throw invalid_argument("serialized db is truncated");
+    }
+
+    auto db = make_unique<vector<Plaintext>>();
+    db->reserve(size);
+    for (uint64_t i = 0; i < size; i++) {
+        Plaintext p;
+        p.unsafe_load(input);
+        db->push_back(move(p));
+    }
+
+    set_database(move(db));
+    is_db_preprocessed_ = (preprocessed == 1);
+}
+
 // Server takes over ownership of db and will free it when it exits
 void PIRServer::set_database(unique_ptr<vector<Plaintext>> &&db) {
     if (!db) {
@@ -3,6 +3,7 @@
 #include "pir.hpp"
 #include <map>
 #include <memory>
+#include <sstream>
 #include <vector>
 #include "pir_client.hpp"
 
@@ -16,6 +17,11 @@ class PIRServer {
     void set_database(const std::unique_ptr<const std::uint8_t[]> &bytes, std::uint64_t ele_num, std::uint64_t ele_size);
     void preprocess_database();
 
+    // serializes the (possibly preprocessed) database such that
+    // it can be restored without repeating the preprocessing
+    std::string serialize_database();
+    void load_database(const std::string &serialized);
+
     std::vector<seal::Ciphertext> expand_query(
             const seal::Ciphertext &encrypted, std::uint32_t m, uint32_t client_id);
 
@@ -240,6 +240,32 @@ extern void* gen_answer_with_expanded_query(void *server_wrapper, void *expanded
 
 }
 
+void* serialize_database(void *server_wrapper) {
+    struct ServerWrapper *sw = (ServerWrapper *)server_wrapper;
+    string ser_db = sw->server->serialize_database();
+
+    SerializedDatabase *ser = new SerializedDatabase();
+    char *str = new char [ser_db.length()+1]; 
+    memcpy(str, ser_db.c_str(), sizeof(char) * (ser_db.length()+1));
+    ser->str = str;
+    ser->str_len = ser_db.length();
+
+    return ser;
+}
+
+// returns 0 on success and -1 if the serialized database is invalid
+// (exceptions must not propagate to the caller through the C interface)
+int load_database(void *server_wrapper, char *data, uint64_t len) {
+    struct ServerWrapper *sw = (ServerWrapper *)server_wrapper;
+    try {
+        string serialized(data, len);
+        sw->server->load_database(serialized);
+    } catch (...) {
+        return -1;
+    }
+    return 0;
+}
+
 
 void free_params(void *params) {
     struct Params *p = (struct Params *)params;
@@ -281,4 +307,10 @@ void free_answer(void *answer) {
     struct SerializedAnswer *a = (struct SerializedAnswer *)answer;
     free((char*)a->str);
     free(a);
-}
\ No newline at end of file
+}
+
+void free_serialized_database(void *serialized_database) {
+    struct SerializedDatabase *db = (struct SerializedDatabase *)serialized_database;
+    delete[] db->str;
+    delete db;
+}
@@ -54,6 +54,11 @@ struct SerializedQuery {
     uint64_t count; 
 };
 
+struct SerializedDatabase {
+    const char *str;
+    uint64_t str_len; 
+};
+
 struct SerializedGaloisKeys {
     const char *str;
     uint64_t str_len; 
@@ -83,12 +88,15 @@ extern void setup_database(void *server_wrapper, char* data);
 extern void* gen_answer(void *server_wrapper, void *serialized_query);
 extern void* gen_expanded_query(void *server_wrapper, void *serialized_query);
 extern void* gen_answer_with_expanded_query(void *server_wrapper, void *expanded_query);
+extern void* serialize_database(void *server_wrapper);
+extern int load_database(void *server_wrapper, char *data, uint64_t len);
 
 // Memory management functions
 extern void free_params(void *params);
 extern void free_expanded_query(void *expanded_query);
 extern void free_query(void *query);
 extern void free_answer(void *answer);
+extern void free_serialized_database(void *serialized_database);
 extern void free_query(void *serialized_query);
 extern void free_client_wrapper(void *client_wrapper);
 extern void free_server_wrapper(void *server_wrapper);
@@ -0,0 +1,249 @@
+package adstore
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"sort"
+)
+
+// number of bytes used to encode the length of a creative
+const lengthHeaderBytes = 4
+
+// Location of an ad in the store
+type Location struct {
+	Class int // size class holding the ad
+	Slot  int // index of the ad within the size class
+}
+
+// Directory describes how the ad creatives are laid out across the items of
+// one database per size class. Each creative is stored with a length header,
+// zero padded to the number of chunks of its size class, and split into
+// chunks of ChunkBytes bytes (one chunk per database item).
+// The directory is public: every client fetches the same number of chunks
+// from every size class regardless of the ad it retrieves.
+type Directory struct {
+	ChunkBytes  int              // bytes per chunk (i.e., per database item)
+	ClassChunks []int            // number of chunks of each ad in each size class
+	ClassSizes  []int            // number of ads in each size class
+	Locations   map[int]Location // location of each ad ID
+}
+
+// DefaultSizeClasses returns size classes (in number of chunks) that double
+// in size up to the number of chunks needed for a creative of maxBytes
+func DefaultSizeClasses(maxBytes, chunkBytes int) []int {
+
+	maxChunks := NumChunks(maxBytes, chunkBytes)
+
+	classes := make([]int, 0)
+	for chunks := 1; ; chunks *= 2 {
+		if chunks >= maxChunks {
+			classes = append(classes, maxChunks)
+			break
+		}
+		classes = append(classes, chunks)
+	}
+
+	return classes
+}
+
+// NumChunks returns the number of chunks needed
+// to store a creative of size bytes (with its length header)
+func NumChunks(size, chunkBytes int) int {
+	return (size + lengthHeaderBytes + chunkBytes - 1) / chunkBytes
+}
+
+// NewDirectory assigns each creative to the smallest size class (in number
+// of chunks, see DefaultSizeClasses) that fits it. Size classes without
+// any ads are omitted from the directory.
+func NewDirectory(creatives map[int][]byte, chunkBytes int, classChunks []int) (*Directory, error) {
+
+	if chunkBytes <= 0 {
+		return nil, errors.New("chunk size must be positive")
+	}
+
+	classes := make([]int, len(classChunks))
+	copy(classes, classChunks)
+	sort.Ints(classes)
+
+	// deterministic layout
+	ids := make([]int, 0, len(creatives))
+	for id := range creatives {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	assigned := make([][]int, len(classes))
+	for _, id := range ids {
+		chunks := NumChunks(len(creatives[id]), chunkBytes)
+		class := sort.SearchInts(classes, chunks)
+		if class == len(classes) {
+			return nil, errors.New("creative is larger than the largest size class")
+		}
+		assigned[class] = append(assigned[class], id)
+	}
+
+	dir := &Directory{
+		ChunkBytes:  chunkBytes,
+		ClassChunks: make([]int, 0),
+		ClassSizes:  make([]int, 0),
+		Locations:   make(map[int]Location),
+	}
+
+	for i, classIDs := range assigned {
+		if len(classIDs) == 0 {
+			continue
+		}
+
+		class := len(dir.ClassChunks)
+		dir.ClassChunks = append(dir.ClassChunks, classes[i])
+		dir.ClassSizes = append(dir.ClassSizes, len(classIDs))
+		for slot, id := range classIDs {
+			dir.Locations[id] = Location{class, slot}
+		}
+	}
+
+	return dir, nil
+}
+
+// NumClasses returns the number of size classes in the directory
+func (dir *Directory) NumClasses() int {
+	return len(dir.ClassChunks)
+}
+
+// NumItems returns the number of (chunk) items in the database of a size class
+func (dir *Directory) NumItems(class int) int {
+	return dir.ClassSizes[class] * dir.ClassChunks[class]
+}
+
+// NumQueries returns the number of (chunk) queries issued by every fetch
+func (dir *Directory) NumQueries() int {
+	n := 0
+	for _, chunks := range dir.ClassChunks {
+		n += chunks
+	}
+	return n
+}
+
+// ClassData returns the database bytes of a size class:
+// the chunks of the ad in slot s are items s*k, ..., s*k + k - 1
+// where k is the number of chunks of the size class
+func (dir *Directory) ClassData(creatives map[int][]byte, class int) ([]byte, error) {
+
+	chunks := dir.ClassChunks[class]
+	adBytes := chunks * dir.ChunkBytes
+	data := make([]byte, dir.ClassSizes[class]*adBytes)
+
+	for id, loc := range dir.Locations {
+		if loc.Class != class {
+			continue
+		}
+
+		encoded, err := EncodeCreative(creatives[id], chunks, dir.ChunkBytes)
+		if err != nil {
+			return nil, err
+		}
+		copy(data[loc.Slot*adBytes:], encoded)
+	}
+
+	return data, nil
+}
+
+// QueryPlan returns the indices of the items to retrieve from each size class
+// to fetch the ad with the given ID: the chunks of the ad from its size class
+// and the chunks of a random ad from every other size class, such that
+// every fetch retrieves the same number of items from each size class
+func (dir *Directory) QueryPlan(adID int) (map[int][]int64, error) {
+
+	loc, ok := dir.Locations[adID]
+	if !ok {
+		return nil, errors.New("ad ID is not in the directory")
+	}
+
+	plan := make(map[int][]int64)
+	for class, chunks := range dir.ClassChunks {
+		slot := rand.Intn(dir.ClassSizes[class])
+		if class == loc.Class {
+			slot = loc.Slot
+		}
+
+		items := make([]int64, chunks)
+		for i := range items {
+			items[i] = int64(slot*chunks + i)
+		}
+		plan[class] = items
+	}
+
+	return plan, nil
+}
+
+// Reassemble returns the creative of the ad with the given ID from the
+// chunks retrieved from its size class (in the order of the QueryPlan)
+func (dir *Directory) Reassemble(adID int, chunks [][]byte) ([]byte, error) {
+
+	loc, ok := dir.Locations[adID]
+	if !ok {
+		return nil, errors.New("ad ID is not in the directory")
+	}
+
+	if len(chunks) != dir.ClassChunks[loc.Class] {
+		return nil, errors.New("wrong number of chunks for the size class")
+	}
+
+	data := make([]byte, 0, len(chunks)*dir.ChunkBytes)
+	for _, chunk := range chunks {
+		if len(chunk) < dir.ChunkBytes {
+			return nil, errors.New("chunk is too short")
+		}
+		data = append(data, chunk[:dir.ChunkBytes]...)
+	}
+
+	return DecodeCreative(data)
+}
+
+// ReadCreative returns the creative of the ad with the
+// given ID from the data of its size class (see ClassData)
+func (dir *Directory) ReadCreative(adID int, classData []byte) ([]byte, error) {
+
+	loc, ok := dir.Locations[adID]
+	if !ok {
+		return nil, errors.New("ad ID is not in the directory")
+	}
+
+	adBytes := dir.ClassChunks[loc.Class] * dir.ChunkBytes
+	if len(classData) < (loc.Slot+1)*adBytes {
+		return nil, errors.New("class data is too short")
+	}
+
+	return DecodeCreative(classData[loc.Slot*adBytes : (loc.Slot+1)*adBytes])
+}
+
+// EncodeCreative prepends the length of the creative and
+// zero pads it to numChunks chunks of chunkBytes bytes
+func EncodeCreative(creative []byte, numChunks, chunkBytes int) ([]byte, error) {
+
+	if NumChunks(len(creative), chunkBytes) > numChunks {
+		return nil, errors.New("creative does not fit in the number of chunks")
+	}
+
+	res := make([]byte, numChunks*chunkBytes)
+	binary.LittleEndian.PutUint32(res, uint32(len(creative)))
+	copy(res[lengthHeaderBytes:], creative)
+
+	return res, nil
+}
+
+// DecodeCreative recovers a creative encoded using EncodeCreative
+func DecodeCreative(data []byte) ([]byte, error) {
+
+	if len(data) < lengthHeaderBytes {
+		return nil, errors.New("creative data is too short")
+	}
+
+	n := int(binary.LittleEndian.Uint32(data))
+	if len(data) < lengthHeaderBytes+n {
+		return nil, errors.New("creative data is too short for its length")
+	}
+
+	return data[lengthHeaderBytes : lengthHeaderBytes+n], nil
+}
@@ -0,0 +1,142 @@
+package adstore
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func getTestCreatives(num, maxBytes int) map[int][]byte {
+	creatives := make(map[int][]byte)
+	for i := 0; i < num; i++ {
+		creative := make([]byte, rand.Intn(maxBytes+1))
+		rand.Read(creative)
+		creatives[3*i] = creative
+	}
+
+	return creatives
+}
+
+func TestDefaultSizeClasses(t *testing.T) {
+	classes := DefaultSizeClasses(10000, 1000)
+
+	expected := []int{1, 2, 4, 8, 11}
+	if len(classes) != len(expected) {
+		t.Fatalf("expected size classes %v, got %v", expected, classes)
+	}
+
+	for i := range expected {
+		if classes[i] != expected[i] {
+			t.Fatalf("expected size classes %v, got %v", expected, classes)
+		}
+	}
+}
+
+func TestEncodeDecodeCreative(t *testing.T) {
+	creative := []byte("a creative that spans several chunks")
+
+	data, err := EncodeCreative(creative, 3, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(data) != 3*16 {
+		t.Fatalf("expected %v bytes, got %v", 3*16, len(data))
+	}
+
+	res, err := DecodeCreative(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(res, creative) {
+		t.Fatalf("creative was not recovered correctly")
+	}
+
+	if _, err := EncodeCreative(creative, 2, 16); err == nil {
+		t.Fatalf("expected an error for a creative that does not fit")
+	}
+}
+
+func TestDirectoryReassemble(t *testing.T) {
+	chunkBytes := 64
+	creatives := getTestCreatives(100, 1000)
+	creatives[1] = []byte{} // empty creative
+
+	dir, err := NewDirectory(creatives, chunkBytes, DefaultSizeClasses(1000, chunkBytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	classData := make([][]byte, dir.NumClasses())
+	for class := range classData {
+		classData[class], err = dir.ClassData(creatives, class)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(classData[class]) != dir.NumItems(class)*chunkBytes {
+			t.Fatalf("wrong size of class %v data", class)
+		}
+	}
+
+	for id, creative := range creatives {
+		plan, err := dir.QueryPlan(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// every fetch retrieves the same number of chunks from each class
+		if len(plan) != dir.NumClasses() {
+			t.Fatalf("expected queries to %v classes, got %v", dir.NumClasses(), len(plan))
+		}
+
+		for class, items := range plan {
+			if len(items) != dir.ClassChunks[class] {
+				t.Fatalf("expected %v queries to class %v, got %v", dir.ClassChunks[class], class, len(items))
+			}
+
+			for _, item := range items {
+				if item < 0 || item >= int64(dir.NumItems(class)) {
+					t.Fatalf("item %v is out of range for class %v", item, class)
+				}
+			}
+		}
+
+		class := dir.Locations[id].Class
+		chunks := make([][]byte, len(plan[class]))
+		for i, item := range plan[class] {
+			chunks[i] = classData[class][item*int64(chunkBytes) : (item+1)*int64(chunkBytes)]
+		}
+
+		res, err := dir.Reassemble(id, chunks)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(res, creative) {
+			t.Fatalf("creative of ad %v was not recovered correctly", id)
+		}
+
+		res, err = dir.ReadCreative(id, classData[class])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(res, creative) {
+			t.Fatalf("creative of ad %v was not read correctly", id)
+		}
+	}
+
+	if _, err := dir.QueryPlan(2); err == nil {
+		t.Fatalf("expected an error for an ad that is not in the directory")
+	}
+}
+
+func TestDirectoryTooLarge(t *testing.T) {
+	creatives := map[int][]byte{0: make([]byte, 1000)}
+
+	if _, err := NewDirectory(creatives, 64, []int{1, 2, 4}); err == nil {
+		t.Fatalf("expected an error for a creative larger than the largest size class")
+	}
+}
@@ -1,6 +1,12 @@
 package anns
 
 import (
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+
 	"github.com/sachaservan/vec"
 )
 
@@ -18,11 +24,86 @@ const (
 	HammingDistance DistanceMetric = iota
 	// EuclideanDistance specifies a euclidean (l2) distance metric
 	EuclideanDistance
+	// AngularDistance specifies an angular (cosine similarity) distance metric
+	AngularDistance
+	// JaccardDistance specifies a jaccard distance metric between sets
+	// (represented as indicator vectors, see SetToVec)
+	JaccardDistance
 )
 
+// ParseDistanceMetric returns the distance metric with the given name
+// (one of "hamming", "euclidean", "angular", or "jaccard")
+func ParseDistanceMetric(name string) (DistanceMetric, error) {
+	switch name {
+	case "hamming":
+		return HammingDistance, nil
+	case "euclidean":
+		return EuclideanDistance, nil
+	case "angular":
+		return AngularDistance, nil
+	case "jaccard":
+		return JaccardDistance, nil
+	default:
+		return 0, errors.New("unknown distance metric " + name)
+	}
+}
+
 // Table stores a set of hash buckets
 type Table struct {
 	Buckets map[string]map[int]bool // hash table for all buckets per LSH table
+
+	keys map[int]string // key of the bucket storing each point (see keyOf)
+}
+
+// newTable returns an empty table
+func newTable() *Table {
+	return &Table{
+		Buckets: make(map[string]map[int]bool),
+		keys:    make(map[int]string),
+	}
+}
+
+// keyOf returns the key of the bucket storing the index-th point.
+// The keys are indexed on first use for tables that were not built
+// by the data structure (e.g., tables restored from a snapshot).
+func (table *Table) keyOf(index int) (string, bool) {
+
+	if table.keys == nil {
+		table.keys = make(map[int]string)
+		for key, bucket := range table.Buckets {
+			for i := range bucket {
+				table.keys[i] = key
+			}
+		}
+	}
+
+	key, ok := table.keys[index]
+	return key, ok
+}
+
+// store adds the index-th point to the bucket with the given key
+func (table *Table) store(key string, bucket map[int]bool, index int) {
+	bucket[index] = true
+	if table.keys != nil {
+		table.keys[index] = key
+	}
+}
+
+// overflowed records the changes made to the table by an overflow policy
+// when the index-th point hashed to a full bucket (see OverflowPolicy)
+func (table *Table) overflowed(index int, changed string, stored bool, displaced []int) {
+
+	if table.keys == nil {
+		return
+	}
+
+	for _, i := range displaced {
+		delete(table.keys, i)
+	}
+
+	if stored {
+		table.keys[index] = changed
+	}
 }
 
 // LSHBasedKNN is a data structure that uses GaussianHash to
@@ -32,6 +113,12 @@ type LSHBasedKNN struct {
 	Data   []*vec.Vec     // copy of the original data vectors
 	Tables map[int]*Table // array of hash tables storing the data
 	Hashes map[int]*LSH   // hash function for each of the numTables tables
+
+	// policy applied when a point hashes to a full bucket (DropNewPolicy if nil)
+	OverflowPolicy OverflowPolicy
+
+	numOverflows int // number of times a point hashed to a full bucket
+	numDisplaced int // number of times a point was left out of a table
 }
 
 // DistanceFunction returns the distance between p and q according to a distance metric
@@ -48,25 +135,392 @@ type LSHParams struct {
 	HashBytes           int            `json:"hash_bytes"`           // hash function output bytes
 	Metric              DistanceMetric `json:"distance_metric"`
 	BucketSize          int            `json:"bucket_size"` // max bucket size in each hash table
+	NumBuckets          int            `json:"num_buckets"` // number of buckets in each hash table (unbounded if 0)
+	Seed                int64          `json:"seed"`        // seed from which the hash functions are derived (random if 0)
 }
 
 // NewLSHBased generates a new KNN datastructure based on LSH
 // using the specified paramters
 // see lsh_nn.go for details
+//
+// If params.Seed is non-zero, the hash functions are derived deterministically
+// from the seed and the parameters such that the same parameters always
+// produce the same hash functions (e.g., clients can regenerate the hash
+// functions of the server from the parameters alone).
 func NewLSHBased(params *LSHParams) (*LSHBasedKNN, error) {
 
+	if params.NumFeatures < 1 {
+		return nil, errors.New("number of features must be positive")
+	}
+
+	if params.NumProbes > 1 && !SupportsMultiProbe(params.Metric) {
+		return nil, errors.New("multiprobing is not supported for the distance metric")
+	}
+
 	knn := &LSHBasedKNN{}
 	knn.Params = params
 
+	// universal hashes are sampled from a secure source unless seeded
+	rng := globalRand
+	var bucketRng *rand.Rand
+	if params.Seed != 0 {
+		rng = rand.New(rand.NewSource(params.Seed))
+		bucketRng = rng
+	}
+
 	// initialize a new set of hashes
 	knn.Hashes = make(map[int]*LSH)
 	knn.Tables = make(map[int]*Table)
 	for i := 0; i < knn.Params.NumTables; i++ {
 		switch knn.Params.Metric {
 		case EuclideanDistance:
-			knn.Hashes[i] = NewEuclideanLSH(knn.Params.NumFeatures, knn.Params.ProjectionWidth, knn.Params.NumProjections)
+			knn.Hashes[i] = newEuclideanLSH(rng, knn.Params.NumFeatures, knn.Params.ProjectionWidth, knn.Params.NumProjections)
+		case HammingDistance:
+			knn.Hashes[i] = newHammingLSH(rng, knn.Params.NumFeatures, knn.Params.NumProjections)
+		case AngularDistance:
+			knn.Hashes[i] = newAngularLSH(rng, knn.Params.NumFeatures, knn.Params.NumProjections)
+		case JaccardDistance:
+			knn.Hashes[i] = newJaccardLSH(rng, knn.Params.NumProjections)
+		default:
+			return nil, errors.New("unsupported distance metric")
+		}
+
+		// compress digests to valid bucket indices
+		if h, ok := knn.Hashes[i]; ok && knn.Params.NumBuckets > 0 {
+			h.boundToBuckets(bucketRng, knn.Params.NumBuckets, knn.Params.HashBytes)
 		}
 	}
 
 	return knn, nil
 }
+
+// BuildWithData hashes every point in data into the buckets of each table.
+// Buckets hold at most maxBucketSize points (unbounded if maxBucketSize <= 0);
+// when a point hashes to a full bucket, the OverflowPolicy decides which
+// points are stored (by default, the new point is not stored in that table).
+// Returns the points that are missing from at least one table.
+func (knn *LSHBasedKNN) BuildWithData(data []*vec.Vec, maxBucketSize int) ([]*vec.Vec, error) {
+
+	if len(knn.Hashes) != knn.Params.NumTables {
+		return nil, errors.New("no hash functions for the specified distance metric")
+	}
+
+	for _, v := range data {
+		if v.Size() != knn.Params.NumFeatures {
+			return nil, errors.New("data point dimension does not match the number of features")
+		}
+	}
+
+	knn.Params.BucketSize = maxBucketSize
+	knn.Data = data
+	knn.Tables = make(map[int]*Table)
+	for t := 0; t < knn.Params.NumTables; t++ {
+		knn.Tables[t] = newTable()
+	}
+
+	// each table is populated independently
+	displaced := make([][]int, knn.Params.NumTables)
+	numOverflows := make([]int, knn.Params.NumTables)
+	policy := knn.overflowPolicy()
+
+	var wg sync.WaitGroup
+	for t := 0; t < knn.Params.NumTables; t++ {
+		wg.Add(1)
+		go func(t int) {
+			defer wg.Done()
+
+			table := knn.Tables[t]
+			h := knn.Hashes[t]
+			for i, v := range data {
+				key := h.StringDigest(v)
+				bucket, ok := table.Buckets[key]
+				if !ok {
+					bucket = make(map[int]bool)
+					table.Buckets[key] = bucket
+				}
+
+				if maxBucketSize > 0 && len(bucket) >= maxBucketSize {
+					changed, stored, indices := policy.Overflow(knn, t, key, i)
+					table.overflowed(i, changed, stored, indices)
+					displaced[t] = append(displaced[t], indices...)
+					numOverflows[t]++
+					continue
+				}
+
+				table.store(key, bucket, i)
+			}
+		}(t)
+	}
+	wg.Wait()
+
+	knn.numOverflows = 0
+	knn.numDisplaced = 0
+	overflowed := make(map[int]bool)
+	for t, indices := range displaced {
+		knn.numOverflows += numOverflows[t]
+		knn.numDisplaced += len(indices)
+		for _, i := range indices {
+			overflowed[i] = true
+		}
+	}
+
+	res := make([]*vec.Vec, 0, len(overflowed))
+	for i := range data {
+		if overflowed[i] {
+			res = append(res, data[i])
+		}
+	}
+
+	return res, nil
+}
+
+// overflowPolicy returns the policy applied to full buckets
+func (knn *LSHBasedKNN) overflowPolicy() OverflowPolicy {
+	if knn.OverflowPolicy == nil {
+		return DropNewPolicy{}
+	}
+	return knn.OverflowPolicy
+}
+
+// OverflowStats returns statistics on the points displaced by bucket overflows
+// since the tables were built
+func (knn *LSHBasedKNN) OverflowStats() OverflowStats {
+
+	stored := make(map[int]bool)
+	for _, table := range knn.Tables {
+		for _, bucket := range table.Buckets {
+			for i := range bucket {
+				stored[i] = true
+			}
+		}
+	}
+
+	numMissing := 0
+	for i, v := range knn.Data {
+		if v != nil && !stored[i] {
+			numMissing++
+		}
+	}
+
+	return OverflowStats{
+		NumOverflows: knn.numOverflows,
+		NumDisplaced: knn.numDisplaced,
+		NumMissing:   numMissing,
+	}
+}
+
+// Query returns (at most) the k closest points to query
+// among all points that collide with it in some table
+func (knn *LSHBasedKNN) Query(query *vec.Vec, k int) ([]*vec.Vec, error) {
+
+	indices, err := knn.QueryIndices(query, k)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*vec.Vec, len(indices))
+	for i, index := range indices {
+		res[i] = knn.Data[index]
+	}
+
+	return res, nil
+}
+
+// QueryIndices is the same as Query but returns
+// the indices of the points in the data rather than the points
+func (knn *LSHBasedKNN) QueryIndices(query *vec.Vec, k int) ([]int, error) {
+
+	if query.Size() != knn.Params.NumFeatures {
+		return nil, errors.New("query dimension does not match the number of features")
+	}
+
+	return knn.Rank(query, knn.Candidates(query), k), nil
+}
+
+// Candidates returns the (deduplicated) indices of all points
+// stored in the buckets that query hashes to across all tables,
+// probing NumProbes buckets in each table (see LSH.MultiProbe)
+func (knn *LSHBasedKNN) Candidates(query *vec.Vec) []int {
+
+	numProbes := knn.Params.NumProbes
+	if numProbes < 1 {
+		numProbes = 1
+	}
+
+	seen := make(map[int]bool)
+	candidates := make([]int, 0)
+	for t := 0; t < len(knn.Tables); t++ {
+		for _, digest := range knn.Hashes[t].MultiProbe(query, numProbes) {
+			key := string(digest.Bytes())
+			for index := range knn.Tables[t].Buckets[key] {
+				if !seen[index] {
+					seen[index] = true
+					candidates = append(candidates, index)
+				}
+			}
+		}
+	}
+
+	// map iteration order is random; keep results deterministic
+	sort.Ints(candidates)
+
+	return candidates
+}
+
+// ProbedBuckets returns the keys of the buckets of table t that a query for v
+// retrieves, in order of the probing sequence (the first one is the bucket of v):
+// one bucket per partition if the tables are compressed to NumBuckets buckets
+// (see RetrieveBuckets) and NumProbes buckets otherwise (see Candidates)
+func (knn *LSHBasedKNN) ProbedBuckets(t int, v *vec.Vec) []string {
+
+	numProbes := knn.Params.NumProbes
+	if numProbes < 1 {
+		numProbes = 1
+	}
+
+	h := knn.Hashes[t]
+	if knn.Params.NumBuckets > 0 {
+		sequence := h.partitionProbeSequence(v, numProbes, knn.Params.NumBuckets/numProbes)
+		keys := make([]string, len(sequence))
+		for i, bucketIndex := range sequence {
+			keys[i] = BucketKey(bucketIndex)
+		}
+		return keys
+	}
+
+	probes := h.MultiProbe(v, numProbes)
+	keys := make([]string, len(probes))
+	for i, digest := range probes {
+		keys[i] = string(digest.Bytes())
+	}
+	return keys
+}
+
+// RetrieveBuckets returns the (deduplicated) indices of the points in the buckets
+// that a client privately retrieves from the tables (one bucket per partition of
+// each table, see LSH.PartitionProbes) along with the number of retrieved buckets
+// and the number of those that were empty. The tables must be built with NumBuckets set.
+func (knn *LSHBasedKNN) RetrieveBuckets(query *vec.Vec) ([]int, int, int) {
+
+	numProbes := knn.Params.NumProbes
+	partitionSize := knn.Params.NumBuckets / numProbes
+
+	seen := make(map[int]bool)
+	candidates := make([]int, 0)
+	numRetrieved := 0
+	numEmpty := 0
+
+	for t := 0; t < knn.Params.NumTables; t++ {
+		items := knn.Hashes[t].PartitionProbes(query, numProbes, partitionSize)
+
+		for partition, item := range items {
+			bucketIndex := int64(partition*partitionSize) + item
+			bucket := knn.Tables[t].Buckets[BucketKey(bucketIndex)]
+
+			numRetrieved++
+			if len(bucket) == 0 {
+				numEmpty++
+			}
+
+			for index := range bucket {
+				if !seen[index] {
+					seen[index] = true
+					candidates = append(candidates, index)
+				}
+			}
+		}
+	}
+
+	// map iteration order is random; keep results deterministic
+	sort.Ints(candidates)
+
+	return candidates, numRetrieved, numEmpty
+}
+
+// Rank sorts the candidate indices by distance to query
+// and returns (at most) the k closest ones
+func (knn *LSHBasedKNN) Rank(query *vec.Vec, candidates []int, k int) []int {
+
+	dist := knn.DistanceFunction()
+
+	distances := make(map[int]float64)
+	for _, index := range candidates {
+		distances[index] = dist(query, knn.Data[index])
+	}
+
+	ranked := make([]int, len(candidates))
+	copy(ranked, candidates)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return distances[ranked[i]] < distances[ranked[j]]
+	})
+
+	if k < len(ranked) {
+		ranked = ranked[:k]
+	}
+
+	return ranked
+}
+
+// DistanceFunction returns the distance function
+// corresponding to the metric in the parameters
+func (knn *LSHBasedKNN) DistanceFunction() DistanceFunction {
+	return MetricDistance(knn.Params.Metric)
+}
+
+// MetricDistance returns the distance function corresponding to the metric
+func MetricDistance(metric DistanceMetric) DistanceFunction {
+	switch metric {
+	case HammingDistance:
+		return vec.HammingDistance
+	case AngularDistance:
+		return AngularDistanceBetween
+	case JaccardDistance:
+		return JaccardDistanceBetween
+	default:
+		return vec.EuclideanDistance
+	}
+}
+
+// AngularDistanceBetween returns the angle between p and q normalized to the range [0, 1]
+func AngularDistanceBetween(p, q *vec.Vec) float64 {
+
+	// NOTE: vec.CosineDistance returns the cosine similarity
+	sim := vec.CosineDistance(p, q)
+	if math.IsNaN(sim) {
+		// angle with the zero vector is undefined
+		return 1
+	}
+
+	sim = math.Max(-1, math.Min(1, sim))
+
+	return math.Acos(sim) / math.Pi
+}
+
+// JaccardDistanceBetween returns one minus the jaccard similarity
+// of the sets represented by the indicator vectors p and q
+func JaccardDistanceBetween(p, q *vec.Vec) float64 {
+
+	if p.Size() != q.Size() {
+		panic("points must have the same dimentions")
+	}
+
+	intersection := 0.0
+	union := 0.0
+	for i := 0; i < p.Size(); i++ {
+		inP := p.Coords[i] != 0
+		inQ := q.Coords[i] != 0
+		if inP && inQ {
+			intersection++
+		}
+		if inP || inQ {
+			union++
+		}
+	}
+
+	if union == 0 {
+		// two empty sets are identical
+		return 0
+	}
+
+	return 1 - intersection/union
+}
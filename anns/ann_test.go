@@ -0,0 +1,282 @@
+package anns
+
+import (
+	"testing"
+
+	"github.com/sachaservan/vec"
+)
+
+var _ KNN = (*LSHBasedKNN)(nil)
+
+func getTestParams() *LSHParams {
+	return &LSHParams{
+		NumFeatures:     10,
+		NumTables:       5,
+		NumProbes:       1,
+		NumProjections:  2,
+		ProjectionWidth: 20,
+		Metric:          EuclideanDistance,
+	}
+}
+
+func getTestData(n, dim int) []*vec.Vec {
+	data := make([]*vec.Vec, n)
+	for i := range data {
+		data[i] = vec.NewRandomVec(dim, -50, 50)
+	}
+	return data
+}
+
+func TestBuildWithData(t *testing.T) {
+	params := getTestParams()
+	knn, err := NewLSHBased(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := getTestData(1000, params.NumFeatures)
+	overflow, err := knn.BuildWithData(data, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for tableIndex, table := range knn.Tables {
+		numStored := 0
+		for _, bucket := range table.Buckets {
+			if len(bucket) > 2 {
+				t.Fatalf("bucket in table %v has %v > 2 points", tableIndex, len(bucket))
+			}
+			numStored += len(bucket)
+		}
+
+		if numStored < len(data)-len(overflow) {
+			t.Fatalf("table %v is missing points: stored %v of %v", tableIndex, numStored, len(data))
+		}
+	}
+}
+
+func TestNewLSHBasedInvalidParams(t *testing.T) {
+	for _, metric := range []DistanceMetric{EuclideanDistance, HammingDistance, AngularDistance, JaccardDistance} {
+		params := getTestParams()
+		params.Metric = metric
+		params.NumFeatures = 0
+
+		if _, err := NewLSHBased(params); err == nil {
+			t.Fatalf("expected an error for no features (metric %v)", metric)
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	params := getTestParams()
+	knn, err := NewLSHBased(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := getTestData(1000, params.NumFeatures)
+	_, err = knn.BuildWithData(data, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		res, err := knn.Query(data[i], 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(res) == 0 || len(res) > 5 {
+			t.Fatalf("expected between 1 and 5 results, got %v", len(res))
+		}
+
+		// every point collides with itself in every table
+		if !res[0].Equal(data[i]) {
+			t.Fatalf("closest point to a data point is not the point itself")
+		}
+
+		for j := 1; j < len(res); j++ {
+			if vec.EuclideanDistance(data[i], res[j-1]) > vec.EuclideanDistance(data[i], res[j]) {
+				t.Fatalf("results are not sorted by distance")
+			}
+		}
+	}
+}
+
+func TestBoundedDigest(t *testing.T) {
+	params := getTestParams()
+	params.NumBuckets = 100
+	params.HashBytes = 4
+
+	knn, err := NewLSHBased(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := getTestData(1000, params.NumFeatures)
+	for _, h := range knn.Hashes {
+		for _, v := range data {
+			index := h.Digest(v).Int64()
+			if index < 0 || index >= int64(params.NumBuckets) {
+				t.Fatalf("digest %v is not in the range [0, %v)", index, params.NumBuckets)
+			}
+		}
+	}
+
+	_, err = knn.BuildWithData(data, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, table := range knn.Tables {
+		if len(table.Buckets) > params.NumBuckets {
+			t.Fatalf("table has %v > %v buckets", len(table.Buckets), params.NumBuckets)
+		}
+	}
+}
+
+func TestQueryHamming(t *testing.T) {
+	params := getTestParams()
+	params.Metric = HammingDistance
+	params.NumFeatures = 32
+	params.NumProjections = 8
+
+	knn, err := NewLSHBased(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := getTestBinaryData(1000, params.NumFeatures)
+	_, err = knn.BuildWithData(data, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		res, err := knn.Query(data[i], 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(res) != 1 || vec.HammingDistance(res[0], data[i]) != 0 {
+			t.Fatalf("closest point to a data point is not at distance zero")
+		}
+	}
+}
+
+func TestQueryAngular(t *testing.T) {
+	params := getTestParams()
+	params.Metric = AngularDistance
+	params.NumProjections = 6
+
+	knn, err := NewLSHBased(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := getTestData(1000, params.NumFeatures)
+	_, err = knn.BuildWithData(data, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		// same direction as the data point
+		query := data[i].Copy().Scale(2)
+
+		res, err := knn.Query(query, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(res) != 1 || AngularDistanceBetween(res[0], query) > 1e-6 {
+			t.Fatalf("closest point is not in the same direction as the query")
+		}
+	}
+}
+
+func TestQueryJaccard(t *testing.T) {
+	params := getTestParams()
+	params.Metric = JaccardDistance
+	params.NumFeatures = 50
+	params.NumProjections = 3
+
+	knn, err := NewLSHBased(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := getTestBinaryData(500, params.NumFeatures)
+	_, err = knn.BuildWithData(data, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		set := make([]int, 0)
+		for j, c := range data[i].Coords {
+			if c != 0 {
+				set = append(set, j)
+			}
+		}
+
+		query, err := SetToVec(set, params.NumFeatures)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := knn.Query(query, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(res) != 1 || JaccardDistanceBetween(res[0], query) != 0 {
+			t.Fatalf("closest set to a data point is not the same set")
+		}
+	}
+}
+
+func TestSeededHashes(t *testing.T) {
+	for _, metric := range []DistanceMetric{EuclideanDistance, HammingDistance, AngularDistance, JaccardDistance} {
+		params := getTestParams()
+		params.Metric = metric
+		params.NumBuckets = 1000
+		params.HashBytes = 4
+		params.Seed = 42
+
+		knn1, err := NewLSHBased(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		paramsCopy := *params
+		knn2, err := NewLSHBased(&paramsCopy)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		paramsCopy.Seed = 43
+		knn3, err := NewLSHBased(&paramsCopy)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data := getTestBinaryData(100, params.NumFeatures)
+		numDifferent := 0
+		for i := 0; i < params.NumTables; i++ {
+			for _, v := range data {
+				if knn1.Hashes[i].Digest(v).Cmp(knn2.Hashes[i].Digest(v)) != 0 {
+					t.Fatalf("hash functions derived from the same seed differ (metric %v)", metric)
+				}
+
+				if knn1.Hashes[i].Digest(v).Cmp(knn3.Hashes[i].Digest(v)) != 0 {
+					numDifferent++
+				}
+			}
+		}
+
+		if numDifferent == 0 {
+			t.Fatalf("hash functions derived from different seeds are identical (metric %v)", metric)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package anns
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/sachaservan/vec"
+)
+
+// number of bytes used to encode the number of entries in a bucket
+const bucketHeaderBytes = 4
+
+// number of bytes used to encode the ID of each entry in a bucket
+const bucketIDBytes = 4
+
+// QuantizedBucketBytes returns the number of bytes needed to encode a bucket
+// holding up to bucketSize quantized vectors (1 byte per coordinate) of dimension dim
+func QuantizedBucketBytes(dim, bucketSize int) int {
+	return bucketHeaderBytes + bucketSize*(bucketIDBytes+dim)
+}
+
+// EncodeQuantizedBucket serializes the (id, vector) pairs of a bucket into a
+// fixed-size byte array of QuantizedBucketBytes(q.Dim(), bucketSize) bytes
+// where each vector is quantized using q. Empty bucket slots are zero padded.
+func EncodeQuantizedBucket(ids []int, vectors []*vec.Vec, q *Quantizer, bucketSize int) ([]byte, error) {
+
+	if len(ids) != len(vectors) {
+		return nil, errors.New("number of ids does not match the number of vectors")
+	}
+
+	if len(ids) > bucketSize {
+		return nil, errors.New("too many entries for the bucket size")
+	}
+
+	res := make([]byte, QuantizedBucketBytes(q.Dim(), bucketSize))
+	binary.LittleEndian.PutUint32(res, uint32(len(ids)))
+
+	pos := bucketHeaderBytes
+	for i, v := range vectors {
+		levels, err := q.Quantize(v)
+		if err != nil {
+			return nil, err
+		}
+
+		binary.LittleEndian.PutUint32(res[pos:], uint32(ids[i]))
+		pos += bucketIDBytes
+
+		for _, level := range levels {
+			res[pos] = byte(level)
+			pos++
+		}
+	}
+
+	return res, nil
+}
+
+// DecodeQuantizedBucket recovers the (id, dequantized vector) pairs
+// from a bucket serialized using EncodeQuantizedBucket
+func DecodeQuantizedBucket(data []byte, q *Quantizer) ([]int, []*vec.Vec, error) {
+
+	if len(data) < bucketHeaderBytes {
+		return nil, nil, errors.New("bucket data is too short")
+	}
+
+	dim := q.Dim()
+	n := int(binary.LittleEndian.Uint32(data))
+	if len(data) < QuantizedBucketBytes(dim, n) {
+		return nil, nil, errors.New("bucket data is too short for the number of entries")
+	}
+
+	ids := make([]int, n)
+	vectors := make([]*vec.Vec, n)
+
+	pos := bucketHeaderBytes
+	for i := 0; i < n; i++ {
+		ids[i] = int(binary.LittleEndian.Uint32(data[pos:]))
+		pos += bucketIDBytes
+
+		levels := make([]int8, dim)
+		for j := range levels {
+			levels[j] = int8(data[pos])
+			pos++
+		}
+
+		v, err := q.Dequantize(levels)
+		if err != nil {
+			return nil, nil, err
+		}
+		vectors[i] = v
+	}
+
+	return ids, vectors, nil
+}
@@ -0,0 +1,65 @@
+package anns
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEncodeDecodeQuantizedBucket(t *testing.T) {
+	dim := 10
+	bucketSize := 4
+
+	ids := []int{3, 17, 42}
+	vectors := getTestData(len(ids), dim)
+
+	q, err := NewQuantizer(vectors)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := EncodeQuantizedBucket(ids, vectors, q, bucketSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(data) != QuantizedBucketBytes(dim, bucketSize) {
+		t.Fatalf("wrong bucket size: expected %v, got %v", QuantizedBucketBytes(dim, bucketSize), len(data))
+	}
+
+	resIDs, resVectors, err := DecodeQuantizedBucket(data, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resIDs) != len(ids) {
+		t.Fatalf("expected %v entries, got %v", len(ids), len(resIDs))
+	}
+
+	for i := range ids {
+		if resIDs[i] != ids[i] {
+			t.Fatalf("entry %v was not recovered correctly", i)
+		}
+
+		for j := range vectors[i].Coords {
+			if math.Abs(resVectors[i].Coords[j]-vectors[i].Coords[j]) > q.Scale[j] {
+				t.Fatalf("entry %v was not dequantized correctly", i)
+			}
+		}
+	}
+}
+
+func TestDecodeEmptyQuantizedBucket(t *testing.T) {
+	q, err := NewQuantizer(getTestData(3, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids, _, err := DecodeQuantizedBucket(make([]byte, QuantizedBucketBytes(10, 2)), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ids) != 0 {
+		t.Fatalf("expected an empty bucket, got %v entries", len(ids))
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"math"
 	"math/big"
+	"math/bits"
 	"math/rand"
 
 	"github.com/sachaservan/vec"
@@ -34,28 +35,79 @@ type GaussianHash struct {
 	r float64
 }
 
+// BitSamplingHash is locality sensitive with respect to Hamming distance
+// see Indyk and Motwani. Approximate Nearest Neighbors: Towards Removing the Curse of Dimensionality
+type BitSamplingHash struct {
+	i int // index of the sampled coordinate
+}
+
+// HyperplaneHash is locality sensitive with respect to angular (cosine) distance
+// see Charikar. Similarity Estimation Techniques from Rounding Algorithms
+type HyperplaneHash struct {
+	a *vec.Vec // normal vector of a random hyperplane (gaussian coordinates)
+}
+
+// MinHash is locality sensitive with respect to Jaccard distance between sets.
+// Sets are represented as indicator vectors: element i is in the set iff coordinate i is non-zero.
+// see Broder. On the Resemblance and Containment of Documents
+type MinHash struct {
+	a uint64 // random permutation h(i) = a*i + b mod p
+	b uint64
+}
+
+// modulus used by the MinHash permutations (Mersenne prime 2^61 - 1)
+const minHashPrime = uint64(1)<<61 - 1
+
 type universalHashMarshallWrapper struct {
 	R1 *gmp.Int
 	R2 *gmp.Int
 	N  *gmp.Int
 }
 
+type bitSamplingHashMarshallWrapper struct {
+	I int // index of the sampled coordinate
+}
+
+type hyperplaneHashMarshallWrapper struct {
+	A *vec.Vec // normal vector of a random hyperplane (gaussian coordinates)
+}
+
+type minHashMarshallWrapper struct {
+	A uint64
+	B uint64
+}
+
 type gaussianlHashMarshallWrapper struct {
 	A *vec.Vec // fixed-point encoded vector of gaussian random variables
 	B float64  // uniformly random value in the range [0, r]
 	R float64
 }
 
+// globalSource is a rand.Source backed by the global math/rand source
+// so that unseeded hash functions are sampled exactly as before
+type globalSource struct{}
+
+func (globalSource) Int63() int64    { return rand.Int63() }
+func (globalSource) Uint64() uint64  { return rand.Uint64() }
+func (globalSource) Seed(seed int64) {}
+
+// globalRand samples from the global math/rand source
+var globalRand = rand.New(globalSource{})
+
 // NewGaussianHash generates a new locality sensitive Gaussian hash for L2 distance metric
 func NewGaussianHash(dim int, r float64) *GaussianHash {
+	return newGaussianHash(globalRand, dim, r)
+}
+
+func newGaussianHash(rng *rand.Rand, dim int, r float64) *GaussianHash {
 
 	a := make([]float64, dim)
 
 	// generate a random float by sampling a scaled int
-	b := float64(rand.Intn(int(r*100000.0)) / 100000.0)
+	b := float64(rng.Intn(int(r*100000.0)) / 100000.0)
 
 	for i := range a {
-		a[i] = rand.NormFloat64()
+		a[i] = rng.NormFloat64()
 	}
 
 	return &GaussianHash{
@@ -63,6 +115,44 @@ func NewGaussianHash(dim int, r float64) *GaussianHash {
 	}
 }
 
+// NewBitSamplingHash generates a new locality sensitive hash for the Hamming distance metric
+// by sampling a random coordinate of the input
+func NewBitSamplingHash(dim int) *BitSamplingHash {
+	return newBitSamplingHash(globalRand, dim)
+}
+
+func newBitSamplingHash(rng *rand.Rand, dim int) *BitSamplingHash {
+	return &BitSamplingHash{rng.Intn(dim)}
+}
+
+// NewHyperplaneHash generates a new locality sensitive hash for the angular distance metric
+// by sampling a random hyperplane through the origin
+func NewHyperplaneHash(dim int) *HyperplaneHash {
+	return newHyperplaneHash(globalRand, dim)
+}
+
+func newHyperplaneHash(rng *rand.Rand, dim int) *HyperplaneHash {
+
+	a := make([]float64, dim)
+	for i := range a {
+		a[i] = rng.NormFloat64()
+	}
+
+	return &HyperplaneHash{vec.NewVec(a)}
+}
+
+// NewMinHash generates a new locality sensitive hash for the Jaccard distance metric
+// by sampling a random (universal) permutation of the set elements
+func NewMinHash() *MinHash {
+	return newMinHash(globalRand)
+}
+
+func newMinHash(rng *rand.Rand) *MinHash {
+	a := uint64(rng.Int63n(int64(minHashPrime-1))) + 1
+	b := uint64(rng.Int63n(int64(minHashPrime)))
+	return &MinHash{a, b}
+}
+
 // NewUniversalHash samples a new universal hash with range hashBytes
 func NewUniversalHash(hashBytes int) *UniversalHash {
 	var r1, r2, n *big.Int
@@ -88,6 +178,33 @@ func NewUniversalHash(hashBytes int) *UniversalHash {
 	}
 }
 
+// newSeededUniversalHash samples a universal hash with range hashBytes
+// deterministically from rng (crypto/rand always uses a secure source)
+func newSeededUniversalHash(rng *rand.Rand, hashBytes int) *UniversalHash {
+
+	// sample a prime with the top two bits set (as in crypto/rand)
+	buf := make([]byte, hashBytes)
+	n := big.NewInt(0)
+	for {
+		rng.Read(buf)
+		buf[0] |= 0xC0
+		buf[len(buf)-1] |= 1
+		n.SetBytes(buf)
+		if n.ProbablyPrime(20) {
+			break
+		}
+	}
+
+	r1 := big.NewInt(0).Rand(rng, n)
+	r2 := big.NewInt(0).Rand(rng, n)
+
+	return &UniversalHash{
+		gmp.NewInt(0).SetBytes(r1.Bytes()),
+		gmp.NewInt(0).SetBytes(r2.Bytes()),
+		gmp.NewInt(0).SetBytes(n.Bytes()),
+	}
+}
+
 // NewUniversalHashWithModulus samples a new universal hash with range [0...n]
 func NewUniversalHashWithModulus(n *gmp.Int) *UniversalHash {
 	var r1, r2 *big.Int
@@ -126,14 +243,140 @@ func (h *GaussianHash) Digest(v *vec.Vec) *gmp.Int {
 	res /= float64(h.r)
 	res = math.Abs(res) // make positive to avoid encoding issues
 
+	// projections beyond the range of int64 (or of non-finite vectors)
+	// are clamped to the last slot to keep the digest a valid hash value
+	if math.IsNaN(res) || res >= math.MaxInt64 {
+		return gmp.NewInt(math.MaxInt64)
+	}
+
 	return gmp.NewInt(int64(math.Floor(res)))
 }
 
+// BoundaryDistances returns the distance (normalized by the width r) from the projection
+// of v to the boundaries of the lower and upper neighboring hash slots
+func (h *GaussianHash) BoundaryDistances(v *vec.Vec) (float64, float64) {
+
+	res, _ := h.a.Dot(v)
+	res += h.b
+	res /= float64(h.r)
+	res = math.Abs(res)
+
+	slot := math.Floor(res)
+	lower := res - slot
+	upper := 1 - lower
+
+	if slot == 0 {
+		// digest is never negative (see Digest)
+		lower = math.Inf(1)
+	}
+
+	return lower, upper
+}
+
 // StringDigest returns the evaluation of the hash on v encoded as a string
 func (h *GaussianHash) StringDigest(v *vec.Vec) string {
 	return string(h.Digest(v).Bytes())
 }
 
+// GetHashParameters returns the index of the sampled coordinate
+func (h *BitSamplingHash) GetHashParameters() int {
+	return h.i
+}
+
+// Digest returns the hash of the binary vector v
+// (any non-zero coordinate is treated as a one)
+func (h *BitSamplingHash) Digest(v *vec.Vec) *gmp.Int {
+
+	if v.Coord(h.i) != 0 {
+		return gmp.NewInt(1)
+	}
+
+	return gmp.NewInt(0)
+}
+
+// BoundaryDistances returns the distance to the slot of the flipped bit
+// (the only neighboring slot). The distance is 1 since no flip is more
+// likely than another to find near neighbors in hamming distance.
+func (h *BitSamplingHash) BoundaryDistances(v *vec.Vec) (float64, float64) {
+
+	if v.Coord(h.i) != 0 {
+		return 1, math.Inf(1)
+	}
+
+	return math.Inf(1), 1
+}
+
+// StringDigest returns the evaluation of the hash on v encoded as a string
+func (h *BitSamplingHash) StringDigest(v *vec.Vec) string {
+	return string(h.Digest(v).Bytes())
+}
+
+// GetHashParameters returns the normal vector of the hyperplane
+func (h *HyperplaneHash) GetHashParameters() *vec.Vec {
+	return h.a
+}
+
+// Digest returns the side of the hyperplane the vector v falls on
+func (h *HyperplaneHash) Digest(v *vec.Vec) *gmp.Int {
+
+	res, _ := h.a.Dot(v)
+	if res >= 0 {
+		return gmp.NewInt(1)
+	}
+
+	return gmp.NewInt(0)
+}
+
+// BoundaryDistances returns the (unnormalized) distance from v to the hyperplane
+// when v would be hashed to the other side of it; a digest of one can
+// only be perturbed down and a digest of zero can only be perturbed up
+func (h *HyperplaneHash) BoundaryDistances(v *vec.Vec) (float64, float64) {
+
+	res, _ := h.a.Dot(v)
+	if res >= 0 {
+		return res, math.Inf(1)
+	}
+
+	return math.Inf(1), -res
+}
+
+// StringDigest returns the evaluation of the hash on v encoded as a string
+func (h *HyperplaneHash) StringDigest(v *vec.Vec) string {
+	return string(h.Digest(v).Bytes())
+}
+
+// GetHashParameters returns the permutation parameters
+func (h *MinHash) GetHashParameters() (uint64, uint64) {
+	return h.a, h.b
+}
+
+// Digest returns the minimum value of the permutation
+// over all elements in the set represented by v.
+// The digest of the empty set is minHashPrime.
+func (h *MinHash) Digest(v *vec.Vec) *gmp.Int {
+
+	min := minHashPrime
+	for i, c := range v.Coords {
+		if c == 0 {
+			continue
+		}
+
+		hi, lo := bits.Mul64(h.a, uint64(i))
+		lo, carry := bits.Add64(lo, h.b, 0)
+		res := bits.Rem64(hi+carry, lo, minHashPrime)
+		if res < min {
+			min = res
+		}
+	}
+
+	return gmp.NewInt(0).SetUint64(min)
+}
+
+// StringDigest returns the evaluation of the hash on v encoded as a string
+func (h *MinHash) StringDigest(v *vec.Vec) string {
+	return string(h.Digest(v).Bytes())
+}
+
 // Digest returns the evaluation of the hash on s
 func (h *UniversalHash) Digest(s *gmp.Int) *gmp.Int {
 	sInt := gmp.NewInt(0)
@@ -255,3 +498,122 @@ func (h *GaussianHash) UnmarshalBinary(data []byte) error {
 
 	return nil
 }
+
+// MarshalBinary is needed in order to encode/decode
+// the hash since its fields are unexported
+func (h *BitSamplingHash) MarshalBinary() ([]byte, error) {
+
+	// wrap struct
+	w := bitSamplingHashMarshallWrapper{
+		h.i,
+	}
+
+	// use default gob encoder
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	if err := enc.Encode(w); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary is needed in order to encode/decode
+// the hash since its fields are unexported
+func (h *BitSamplingHash) UnmarshalBinary(data []byte) error {
+
+	if len(data) == 0 {
+		return nil
+	}
+
+	w := bitSamplingHashMarshallWrapper{}
+
+	reader := bytes.NewReader(data)
+	dec := gob.NewDecoder(reader)
+	if err := dec.Decode(&w); err != nil {
+		return err
+	}
+
+	h.i = w.I
+
+	return nil
+}
+
+// MarshalBinary is needed in order to encode/decode
+// the hash since its fields are unexported
+func (h *HyperplaneHash) MarshalBinary() ([]byte, error) {
+
+	// wrap struct
+	w := hyperplaneHashMarshallWrapper{
+		h.a,
+	}
+
+	// use default gob encoder
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	if err := enc.Encode(w); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary is needed in order to encode/decode
+// the hash since its fields are unexported
+func (h *HyperplaneHash) UnmarshalBinary(data []byte) error {
+
+	if len(data) == 0 {
+		return nil
+	}
+
+	w := hyperplaneHashMarshallWrapper{}
+
+	reader := bytes.NewReader(data)
+	dec := gob.NewDecoder(reader)
+	if err := dec.Decode(&w); err != nil {
+		return err
+	}
+
+	h.a = w.A
+
+	return nil
+}
+
+// MarshalBinary is needed in order to encode/decode
+// the hash since its fields are unexported
+func (h *MinHash) MarshalBinary() ([]byte, error) {
+
+	// wrap struct
+	w := minHashMarshallWrapper{
+		h.a,
+		h.b,
+	}
+
+	// use default gob encoder
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	if err := enc.Encode(w); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary is needed in order to encode/decode
+// the hash since its fields are unexported
+func (h *MinHash) UnmarshalBinary(data []byte) error {
+
+	if len(data) == 0 {
+		return nil
+	}
+
+	w := minHashMarshallWrapper{}
+
+	reader := bytes.NewReader(data)
+	dec := gob.NewDecoder(reader)
+	if err := dec.Decode(&w); err != nil {
+		return err
+	}
+
+	h.a = w.A
+	h.b = w.B
+
+	return nil
+}
@@ -1,11 +1,46 @@
 package anns
 
 import (
+	"bytes"
+	"encoding/gob"
+	"math"
 	"testing"
 
 	"github.com/ncw/gmp"
+	"github.com/sachaservan/vec"
 )
 
+func init() {
+	gob.Register(&GaussianHash{})
+	gob.Register(&BitSamplingHash{})
+	gob.Register(&HyperplaneHash{})
+	gob.Register(&MinHash{})
+}
+
+// gobRoundTrip encodes and decodes the LSH in the same
+// way as the server sends the hash functions to the client
+func gobRoundTrip(t *testing.T, lsh *LSH) *LSH {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(lsh); err != nil {
+		t.Fatal(err)
+	}
+
+	res := &LSH{}
+	if err := gob.NewDecoder(&buf).Decode(res); err != nil {
+		t.Fatal(err)
+	}
+
+	return res
+}
+
+func getTestBinaryData(n, dim int) []*vec.Vec {
+	data := make([]*vec.Vec, n)
+	for i := range data {
+		data[i] = vec.NewRandomVec(dim, 0, 1)
+	}
+	return data
+}
+
 func TestUniversalHashBuild(t *testing.T) {
 	for i := 2; i < 100; i++ {
 		NewUniversalHash(i)
@@ -22,3 +57,94 @@ func TestUniversalHashDigestSize(t *testing.T) {
 		}
 	}
 }
+
+func TestGaussianHashDigestClamped(t *testing.T) {
+	h := NewGaussianHash(2, 1)
+
+	for _, v := range []*vec.Vec{
+		vec.NewVec([]float64{1e300, -1e300}),
+		vec.NewVec([]float64{math.Inf(1), 0}),
+		vec.NewVec([]float64{math.NaN(), 0}),
+	} {
+		d := h.Digest(v)
+		if d.Sign() < 0 || d.BitLen() > 63 {
+			t.Fatalf("digest %v of %v is not a valid hash value", d, v)
+		}
+
+		// must not panic
+		EncodeHashes(d, d)
+	}
+}
+
+func TestBitSamplingHashDigest(t *testing.T) {
+	h := NewBitSamplingHash(10)
+	for _, v := range getTestBinaryData(100, 10) {
+		if h.Digest(v).Int64() != int64(v.Coord(h.GetHashParameters())) {
+			t.Fatalf("digest does not match the sampled bit")
+		}
+	}
+}
+
+func TestBitSamplingHashMarshal(t *testing.T) {
+	lsh := NewHammingLSH(10, 5)
+	res := gobRoundTrip(t, lsh)
+
+	for _, v := range getTestBinaryData(100, 10) {
+		if lsh.Digest(v).Cmp(res.Digest(v)) != 0 {
+			t.Fatalf("decoded hash does not match the original")
+		}
+	}
+}
+
+func TestHyperplaneHashScaleInvariant(t *testing.T) {
+	h := NewHyperplaneHash(10)
+	for _, v := range getTestData(100, 10) {
+		scaled := v.Copy().Scale(3.5)
+		if h.Digest(v).Cmp(h.Digest(scaled)) != 0 {
+			t.Fatalf("digest changed when scaling the input")
+		}
+	}
+}
+
+func TestHyperplaneHashMarshal(t *testing.T) {
+	lsh := NewAngularLSH(10, 5)
+	res := gobRoundTrip(t, lsh)
+
+	for _, v := range getTestData(100, 10) {
+		if lsh.Digest(v).Cmp(res.Digest(v)) != 0 {
+			t.Fatalf("decoded hash does not match the original")
+		}
+	}
+}
+
+func TestMinHashCollisionProbability(t *testing.T) {
+
+	// sets with jaccard similarity 1/3
+	a, _ := SetToVec([]int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, 20)
+	b, _ := SetToVec([]int{5, 6, 7, 8, 9, 10, 11, 12, 13, 14}, 20)
+
+	trials := 2000
+	collisions := 0
+	for i := 0; i < trials; i++ {
+		h := NewMinHash()
+		if h.Digest(a).Cmp(h.Digest(b)) == 0 {
+			collisions++
+		}
+	}
+
+	rate := float64(collisions) / float64(trials)
+	if rate < 0.25 || rate > 0.42 {
+		t.Fatalf("collision rate %v is far from the jaccard similarity 0.33", rate)
+	}
+}
+
+func TestMinHashMarshal(t *testing.T) {
+	lsh := NewJaccardLSH(5)
+	res := gobRoundTrip(t, lsh)
+
+	for _, v := range getTestBinaryData(100, 10) {
+		if lsh.Digest(v).Cmp(res.Digest(v)) != 0 {
+			t.Fatalf("decoded hash does not match the original")
+		}
+	}
+}
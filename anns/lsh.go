@@ -1,6 +1,11 @@
 package anns
 
 import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"math/rand"
+
 	"github.com/ncw/gmp"
 	"github.com/sachaservan/vec"
 )
@@ -10,9 +15,13 @@ type EuclideanLSH struct {
 	Hset []Hash
 }
 
-// LSH is a set of locality sensitive hash functions
+// LSH is a set of locality sensitive hash functions.
+// If UHash is set, the (concatenated) digest is compressed
+// into a bucket index in the range [0, NumBuckets).
 type LSH struct {
-	Hset []Hash
+	Hset       []Hash
+	UHash      *UniversalHash // universal hash used to compress the digest
+	NumBuckets int            // number of buckets the digest is compressed to
 }
 
 // NewEuclideanLSH samples an LSH for L2 norm with dimension dim and parameters:
@@ -22,10 +31,77 @@ type LSH struct {
 // https://dl.acm.org/doi/pdf/10.1145/997817.997857
 // for more details on the construction
 func NewEuclideanLSH(dim int, r float64, k int) *LSH {
+	return newEuclideanLSH(globalRand, dim, r, k)
+}
+
+func newEuclideanLSH(rng *rand.Rand, dim int, r float64, k int) *LSH {
+
+	hashes := make([]Hash, k)
+	for i := range hashes {
+		hashes[i] = newGaussianHash(rng, dim, r)
+	}
+
+	return &LSH{
+		Hset: hashes,
+	}
+}
+
+// NewHammingLSH samples an LSH for Hamming distance with dimension dim and parameters:
+// k: number of concatenated bit sampling hash functions for amplification
+// see Indyk and Motwani. Approximate Nearest Neighbors: Towards Removing the Curse of Dimensionality
+// https://dl.acm.org/doi/10.1145/276698.276876
+// for more details on the construction
+func NewHammingLSH(dim int, k int) *LSH {
+	return newHammingLSH(globalRand, dim, k)
+}
+
+func newHammingLSH(rng *rand.Rand, dim int, k int) *LSH {
+
+	hashes := make([]Hash, k)
+	for i := range hashes {
+		hashes[i] = newBitSamplingHash(rng, dim)
+	}
+
+	return &LSH{
+		Hset: hashes,
+	}
+}
+
+// NewAngularLSH samples an LSH for angular (cosine) distance with dimension dim and parameters:
+// k: number of concatenated random hyperplane hash functions for amplification
+// see Charikar. Similarity Estimation Techniques from Rounding Algorithms
+// https://dl.acm.org/doi/10.1145/509907.509965
+// for more details on the construction
+func NewAngularLSH(dim int, k int) *LSH {
+	return newAngularLSH(globalRand, dim, k)
+}
+
+func newAngularLSH(rng *rand.Rand, dim int, k int) *LSH {
+
+	hashes := make([]Hash, k)
+	for i := range hashes {
+		hashes[i] = newHyperplaneHash(rng, dim)
+	}
+
+	return &LSH{
+		Hset: hashes,
+	}
+}
+
+// NewJaccardLSH samples an LSH for Jaccard distance between sets with parameters:
+// k: number of concatenated MinHash functions for amplification
+// see Broder. On the Resemblance and Containment of Documents
+// https://ieeexplore.ieee.org/document/666900
+// for more details on the construction
+func NewJaccardLSH(k int) *LSH {
+	return newJaccardLSH(globalRand, k)
+}
+
+func newJaccardLSH(rng *rand.Rand, k int) *LSH {
 
 	hashes := make([]Hash, k)
 	for i := range hashes {
-		hashes[i] = NewGaussianHash(dim, r)
+		hashes[i] = newMinHash(rng)
 	}
 
 	return &LSH{
@@ -33,46 +109,136 @@ func NewEuclideanLSH(dim int, r float64, k int) *LSH {
 	}
 }
 
+// SetToVec returns the indicator vector of a set of elements
+// in the range [0, dim) used to hash sets with a Jaccard LSH
+func SetToVec(set []int, dim int) (*vec.Vec, error) {
+
+	coords := make([]float64, dim)
+	for _, e := range set {
+		if e < 0 || e >= dim {
+			return nil, errors.New("set element is out of range")
+		}
+		coords[e] = 1
+	}
+
+	return vec.NewVec(coords), nil
+}
+
+// SetDigest outputs the encoded LSH digest of a set
+// of elements in the range [0, dim) (see SetToVec)
+func (lsh *LSH) SetDigest(set []int, dim int) (*gmp.Int, error) {
+
+	v, err := SetToVec(set, dim)
+	if err != nil {
+		return nil, err
+	}
+
+	return lsh.Digest(v), nil
+}
+
 // GetHashSet returns the set of hashes comprising the LSH
 func (lsh *LSH) GetHashSet() []Hash {
 	return lsh.Hset
 }
 
-// EncodeHashesToInt returns an encoding (single gmp.Int) of all the hashes
-func EncodeHashesToInt(values ...*gmp.Int) *gmp.Int {
+// BoundToBuckets samples a universal hash used to map the digest
+// of the LSH to a bucket index in the range [0, numBuckets).
+// The universal hash operates modulo a prime of (at least) hashBytes bytes.
+func (lsh *LSH) BoundToBuckets(numBuckets int, hashBytes int) {
+	lsh.boundToBuckets(nil, numBuckets, hashBytes)
+}
+
+// boundToBuckets samples the universal hash from rng
+// (or from a secure source if rng is nil)
+func (lsh *LSH) boundToBuckets(rng *rand.Rand, numBuckets int, hashBytes int) {
+
+	// the prime modulus must be larger than the number of buckets
+	minBytes := (bits.Len64(uint64(numBuckets)) + 8) / 8
+	if hashBytes < minBytes {
+		hashBytes = minBytes
+	}
+
+	if rng != nil {
+		lsh.UHash = newSeededUniversalHash(rng, hashBytes)
+	} else {
+		lsh.UHash = NewUniversalHash(hashBytes)
+	}
+	lsh.NumBuckets = numBuckets
+}
 
-	// NOTE: this encoding strategy assumes that each LSH in Hset is a "1-bit" LSH.
-	// To encode concatenation, output SUM 2^i * h_i(x) which encodes the bits as an integer
+// number of bytes used to encode each hash value in EncodeHashes
+const hashValueBytes = 8
 
-	// TODO: make this encoding compatible with any base. Currently slow and inefficient.
+// EncodeHashes returns a collision-free encoding of a tuple of hash values
+// by packing each value into a fixed-width (8 byte) big-endian word.
+// Each hash value must be non-negative and fit in 64 bits.
+func EncodeHashes(values ...*gmp.Int) []byte {
 
-	res := gmp.NewInt(0)
-	pow := gmp.NewInt(2)
-	for _, d := range values {
-		d.Mul(d, pow)
-		res.Add(res, d)
+	res := make([]byte, hashValueBytes*len(values))
+	for i, d := range values {
+		if d.Sign() < 0 || d.BitLen() > 8*hashValueBytes {
+			panic("hash value does not fit in a 64-bit word")
+		}
 
-		// next power of 2
-		pow.Mul(pow, gmp.NewInt(2))
+		binary.BigEndian.PutUint64(res[i*hashValueBytes:], d.Uint64())
 	}
 
 	return res
 }
 
+// EncodeHashesToInt returns an encoding (single gmp.Int) of all the hashes.
+// For a fixed number of hashes the encoding is collision-free (see EncodeHashes).
+func EncodeHashesToInt(values ...*gmp.Int) *gmp.Int {
+	return gmp.NewInt(0).SetBytes(EncodeHashes(values...))
+}
+
+// Hashes outputs the value of each hash in the LSH on input v
+func (lsh *LSH) Hashes(v *vec.Vec) []*gmp.Int {
+
+	values := make([]*gmp.Int, len(lsh.Hset))
+	for i, h := range lsh.Hset {
+		values[i] = h.Digest(v)
+	}
+
+	return values
+}
+
 // Digest outputs the encoded LSH digest of input v
 func (lsh *LSH) Digest(v *vec.Vec) *gmp.Int {
+	return lsh.DigestFromHashes(lsh.Hashes(v))
+}
 
-	digests := make([]*gmp.Int, len(lsh.Hset))
-	for i, h := range lsh.Hset {
-		d := h.Digest(v)
-		digests[i] = d
+// DigestFromHashes outputs the encoded LSH digest given
+// the value of each hash in the LSH (see Hashes)
+func (lsh *LSH) DigestFromHashes(values []*gmp.Int) *gmp.Int {
+
+	res := EncodeHashesToInt(values...)
+	if lsh.UHash != nil {
+		res = lsh.UHash.Digest(res)
+		res.Mod(res, gmp.NewInt(int64(lsh.NumBuckets)))
 	}
 
-	return EncodeHashesToInt(digests...)
+	return res
 }
 
 // StringDigest outputs a string representation of the digest of v
 func (lsh *LSH) StringDigest(v *vec.Vec) string {
-	res := lsh.Digest(v)
-	return string(res.Bytes())
+	return lsh.StringDigestFromHashes(lsh.Hashes(v))
+}
+
+// StringDigestFromHashes outputs a string representation of the digest
+// given the value of each hash in the LSH (see Hashes)
+func (lsh *LSH) StringDigestFromHashes(values []*gmp.Int) string {
+	return string(lsh.DigestFromHashes(values).Bytes())
+}
+
+// StringDigestToInt returns the digest encoded by StringDigest
+func StringDigestToInt(digest string) *gmp.Int {
+	return gmp.NewInt(0).SetBytes([]byte(digest))
+}
+
+// BucketKey returns the key of the bucket at the given index in a table
+// whose digests are compressed to bucket indices (see BoundToBuckets)
+func BucketKey(index int64) string {
+	return string(gmp.NewInt(index).Bytes())
 }
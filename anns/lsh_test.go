@@ -0,0 +1,47 @@
+package anns
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ncw/gmp"
+)
+
+func TestEncodeHashesNoCollisions(t *testing.T) {
+
+	// tuples that collide under a "1-bit" encoding
+	a := EncodeHashes(gmp.NewInt(2), gmp.NewInt(0))
+	b := EncodeHashes(gmp.NewInt(0), gmp.NewInt(1))
+	if bytes.Equal(a, b) {
+		t.Fatalf("distinct hash tuples have the same encoding")
+	}
+
+	seen := make(map[string]bool)
+	for i := int64(0); i < 20; i++ {
+		for j := int64(0); j < 20; j++ {
+			key := EncodeHashesToInt(gmp.NewInt(i), gmp.NewInt(j)).String()
+			if seen[key] {
+				t.Fatalf("collision on (%v, %v)", i, j)
+			}
+			seen[key] = true
+		}
+	}
+}
+
+func TestEncodeHashesDoesNotMutate(t *testing.T) {
+	values := []*gmp.Int{gmp.NewInt(3), gmp.NewInt(5)}
+	EncodeHashesToInt(values...)
+
+	if values[0].Int64() != 3 || values[1].Int64() != 5 {
+		t.Fatalf("encoding modified the hash values")
+	}
+}
+
+func TestStringDigestMatchesDigest(t *testing.T) {
+	lsh := NewEuclideanLSH(10, 20, 4)
+	for _, v := range getTestData(100, 10) {
+		if StringDigestToInt(lsh.StringDigest(v)).Cmp(lsh.Digest(v)) != 0 {
+			t.Fatalf("string digest does not match the digest")
+		}
+	}
+}
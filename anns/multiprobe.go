@@ -0,0 +1,249 @@
+package anns
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+
+	"github.com/ncw/gmp"
+	"github.com/sachaservan/vec"
+)
+
+// ProbeableHash is a Hash with neighboring hash slots that
+// can be probed in order of likelihood of containing near neighbors
+type ProbeableHash interface {
+	Hash
+
+	// BoundaryDistances returns the distance from v to the lower
+	// (digest - 1) and upper (digest + 1) neighboring hash slots.
+	// A distance of +Inf indicates that the neighboring slot does not exist.
+	BoundaryDistances(v *vec.Vec) (float64, float64)
+}
+
+// perturbation of the hash value at index i by delta (-1 or +1)
+type perturbation struct {
+	i     int
+	delta int64
+	dist  float64 // distance to the boundary of the perturbed slot
+}
+
+// perturbationSet is a set of indices into the (sorted) list of perturbations
+type perturbationSet struct {
+	indices []int
+	score   float64 // sum of the squared boundary distances
+}
+
+// perturbationHeap is a min-heap of perturbation sets ordered by score
+type perturbationHeap []*perturbationSet
+
+func (h perturbationHeap) Len() int            { return len(h) }
+func (h perturbationHeap) Less(i, j int) bool  { return h[i].score < h[j].score }
+func (h perturbationHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *perturbationHeap) Push(x interface{}) { *h = append(*h, x.(*perturbationSet)) }
+func (h *perturbationHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// MultiProbeHashes returns (up to) numProbes hash value tuples (see Hashes)
+// to probe for near neighbors of v in order of decreasing likelihood.
+// The first tuple is always the hash of v itself.
+// If a hash in the LSH is not a ProbeableHash, only the hash of v is returned.
+// see Lv et al. Multi-Probe LSH: Efficient Indexing for High-Dimensional Similarity Search
+// https://dl.acm.org/doi/10.5555/1325851.1325958
+// for details on the query-directed probing sequence
+func (lsh *LSH) MultiProbeHashes(v *vec.Vec, numProbes int) [][]*gmp.Int {
+
+	values := lsh.Hashes(v)
+	res := [][]*gmp.Int{values}
+
+	// distance to the boundary of each neighboring slot
+	perturbations := make([]*perturbation, 0, 2*len(lsh.Hset))
+	for i, h := range lsh.Hset {
+		ph, ok := h.(ProbeableHash)
+		if !ok {
+			return res
+		}
+
+		lower, upper := ph.BoundaryDistances(v)
+		perturbations = append(perturbations, &perturbation{i, -1, lower})
+		perturbations = append(perturbations, &perturbation{i, 1, upper})
+	}
+
+	sort.SliceStable(perturbations, func(i, j int) bool {
+		return perturbations[i].dist < perturbations[j].dist
+	})
+
+	score := func(indices []int) float64 {
+		s := 0.0
+		for _, j := range indices {
+			s += perturbations[j].dist * perturbations[j].dist
+		}
+		return s
+	}
+
+	// a set is valid if it perturbs each hash value at most once
+	valid := func(indices []int) bool {
+		seen := make(map[int]bool)
+		for _, j := range indices {
+			if seen[perturbations[j].i] {
+				return false
+			}
+			seen[perturbations[j].i] = true
+		}
+		return true
+	}
+
+	h := &perturbationHeap{}
+	heap.Push(h, &perturbationSet{[]int{0}, score([]int{0})})
+
+	for len(res) < numProbes && h.Len() > 0 {
+		set := heap.Pop(h).(*perturbationSet)
+		if math.IsInf(set.score, 1) {
+			// all remaining sets contain a slot that does not exist
+			break
+		}
+
+		// generate the next sets by shifting and expanding the largest index
+		last := set.indices[len(set.indices)-1]
+		if last+1 < len(perturbations) {
+			shifted := append(append([]int{}, set.indices[:len(set.indices)-1]...), last+1)
+			heap.Push(h, &perturbationSet{shifted, score(shifted)})
+
+			expanded := append(append([]int{}, set.indices...), last+1)
+			heap.Push(h, &perturbationSet{expanded, score(expanded)})
+		}
+
+		if !valid(set.indices) {
+			continue
+		}
+
+		probe := make([]*gmp.Int, len(values))
+		for i := range values {
+			probe[i] = gmp.NewInt(0).Set(values[i])
+		}
+
+		for _, j := range set.indices {
+			p := perturbations[j]
+			probe[p.i].Add(probe[p.i], gmp.NewInt(p.delta))
+		}
+
+		res = append(res, probe)
+	}
+
+	return res
+}
+
+// MultiProbe returns the digests of (up to) numProbes distinct buckets
+// to probe for near neighbors of v in order of decreasing likelihood
+// (see MultiProbeHashes). The first digest is always the digest of v.
+func (lsh *LSH) MultiProbe(v *vec.Vec, numProbes int) []*gmp.Int {
+
+	if numProbes < 1 {
+		numProbes = 1
+	}
+
+	res := make([]*gmp.Int, 0, numProbes)
+	seen := make(map[string]bool)
+
+	// distinct probes can map to the same bucket once compressed;
+	// ask for more probes until there are enough distinct buckets
+	// (the probing sequence for n probes is a prefix of the one for 2n)
+	consumed := 0
+	for n := numProbes; ; n *= 2 {
+		probes := lsh.MultiProbeHashes(v, n)
+		for _, values := range probes[consumed:] {
+			key := lsh.StringDigestFromHashes(values)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			res = append(res, lsh.DigestFromHashes(values))
+
+			if len(res) == numProbes {
+				return res
+			}
+		}
+
+		consumed = len(probes)
+		if len(probes) < n {
+			// no more buckets to probe
+			return res
+		}
+	}
+}
+
+// number of probes (per partition) after which PartitionProbes
+// stops looking for a bucket in the remaining partitions
+const maxPartitionProbes = 32
+
+// PartitionProbes returns the bucket to retrieve from each partition of a table
+// with numProbes partitions of partitionSize buckets each (bucket i is in partition
+// i / partitionSize at index i % partitionSize). The buckets are chosen in order of
+// the probing sequence (see MultiProbe): only the first probe that falls into a
+// partition is retrieved, so the sequence is extended beyond numProbes probes until
+// every partition has a bucket. Partitions that none of the first
+// maxPartitionProbes * numProbes probes falls into (e.g., when the sequence
+// has fewer buckets than partitions) are omitted.
+func (lsh *LSH) PartitionProbes(v *vec.Vec, numProbes, partitionSize int) map[int]int64 {
+
+	items := make(map[int]int64)
+	for _, bucketIndex := range lsh.partitionProbeSequence(v, numProbes, partitionSize) {
+		items[int(bucketIndex)/partitionSize] = bucketIndex % int64(partitionSize)
+	}
+
+	return items
+}
+
+// partitionProbeSequence returns the indices of the buckets retrieved by
+// PartitionProbes in order of the probing sequence (the first one is the bucket of v)
+func (lsh *LSH) partitionProbeSequence(v *vec.Vec, numProbes, partitionSize int) []int64 {
+
+	// the probing sequence for n probes is a prefix of the one for 2n
+	for n := numProbes; ; n *= 2 {
+		probes := lsh.MultiProbe(v, n)
+
+		res := make([]int64, 0, numProbes)
+		used := make(map[int]bool)
+		for _, digest := range probes {
+
+			// digest is a bucket index in the range [0, numProbes * partitionSize)
+			bucketIndex := digest.Int64()
+			partition := int(bucketIndex) / partitionSize
+			if !used[partition] {
+				used[partition] = true
+				res = append(res, bucketIndex)
+			}
+		}
+
+		if len(res) >= numProbes || len(probes) < n || n >= maxPartitionProbes*numProbes {
+			return res
+		}
+	}
+}
+
+// SupportsMultiProbe returns true if the hashes of the metric have neighboring
+// slots to probe (see ProbeableHash). Only the bucket of the query itself
+// can be probed in each table otherwise.
+func SupportsMultiProbe(metric DistanceMetric) bool {
+	return metric != JaccardDistance
+}
+
+// PartitionedNumBuckets returns the number of buckets in each table when the
+// numBuckets buckets of the table are split into numProbes partitions (one PIR
+// database each) whose size is rounded up to a multiple of numParallel
+// (the parallelism of the databases). Digests are compressed to this many buckets.
+func PartitionedNumBuckets(numBuckets, numProbes, numParallel int) int {
+
+	if numParallel < 1 {
+		numParallel = 1
+	}
+
+	partitionSize := int(math.Ceil(float64(numBuckets) / float64(numProbes)))
+	partitionSize = numParallel * int(math.Ceil(float64(partitionSize)/float64(numParallel)))
+
+	return partitionSize * numProbes
+}
@@ -0,0 +1,136 @@
+package anns
+
+import (
+	"testing"
+
+	"github.com/sachaservan/vec"
+)
+
+func TestMultiProbeSequence(t *testing.T) {
+	lsh := NewEuclideanLSH(10, 20, 5)
+
+	for _, v := range getTestData(100, 10) {
+		probes := lsh.MultiProbe(v, 10)
+		if len(probes) != 10 {
+			t.Fatalf("expected 10 probes, got %v", len(probes))
+		}
+
+		if probes[0].Cmp(lsh.Digest(v)) != 0 {
+			t.Fatalf("first probe is not the digest of the query")
+		}
+
+		seen := make(map[string]bool)
+		for _, p := range probes {
+			if seen[p.String()] {
+				t.Fatalf("probe sequence contains duplicate buckets")
+			}
+			seen[p.String()] = true
+		}
+	}
+}
+
+func TestMultiProbeBoundedDigests(t *testing.T) {
+	lsh := NewAngularLSH(10, 8)
+	lsh.BoundToBuckets(50, 4)
+
+	for _, v := range getTestData(100, 10) {
+		for _, p := range lsh.MultiProbe(v, 20) {
+			if p.Int64() < 0 || p.Int64() >= 50 {
+				t.Fatalf("probe %v is not in the range [0, 50)", p)
+			}
+		}
+	}
+}
+
+func TestMultiProbeImprovesRecall(t *testing.T) {
+	params := getTestParams()
+	params.NumTables = 2
+	params.NumProjections = 6
+	params.ProjectionWidth = 10
+
+	knn, err := NewLSHBased(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := getTestData(1000, params.NumFeatures)
+	_, err = knn.BuildWithData(data, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	single := 0
+	multi := 0
+	for i := 0; i < 100; i++ {
+		// query close to (but not at) the data point
+		query := data[i].Copy()
+		query.Add(vec.NewRandomVec(params.NumFeatures, -2, 2))
+
+		knn.Params.NumProbes = 1
+		single += len(knn.Candidates(query))
+
+		knn.Params.NumProbes = 20
+		multi += len(knn.Candidates(query))
+	}
+
+	if multi <= single {
+		t.Fatalf("multiprobing did not increase the number of candidates (%v vs %v)", multi, single)
+	}
+}
+
+func TestPartitionProbesFillsPartitions(t *testing.T) {
+	numProbes := 10
+	partitionSize := 100
+
+	lsh := NewEuclideanLSH(10, 20, 5)
+	lsh.BoundToBuckets(numProbes*partitionSize, 4)
+
+	for _, v := range getTestData(100, 10) {
+		items := lsh.PartitionProbes(v, numProbes, partitionSize)
+		if len(items) != numProbes {
+			t.Fatalf("expected a bucket in each of the %v partitions, got %v", numProbes, len(items))
+		}
+
+		// the bucket of the query is always retrieved
+		digest := lsh.Digest(v).Int64()
+		if items[int(digest)/partitionSize] != digest%int64(partitionSize) {
+			t.Fatalf("bucket of the query is not retrieved")
+		}
+	}
+}
+
+func TestMultiProbeHamming(t *testing.T) {
+	lsh := NewHammingLSH(10, 4)
+
+	for _, v := range getTestBinaryData(100, 10) {
+		values := lsh.Hashes(v)
+		probes := lsh.MultiProbeHashes(v, 5)
+		if len(probes) != 5 {
+			t.Fatalf("expected 5 probes, got %v", len(probes))
+		}
+
+		// the probes after the query flip a single sampled bit
+		for _, probe := range probes[1:] {
+			flipped := 0
+			for i := range probe {
+				if probe[i].Cmp(values[i]) != 0 {
+					flipped++
+				}
+			}
+
+			if flipped != 1 {
+				t.Fatalf("probe flips %v bits, expected 1", flipped)
+			}
+		}
+	}
+}
+
+func TestMultiProbeUnsupported(t *testing.T) {
+	params := getTestParams()
+	params.Metric = JaccardDistance
+	params.NumProbes = 2
+
+	if _, err := NewLSHBased(params); err == nil {
+		t.Fatalf("expected an error for multiprobing jaccard hashes")
+	}
+}
@@ -0,0 +1,209 @@
+package anns
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+// OverflowPolicy decides what happens when a point hashes to a full bucket
+// (i.e., a bucket that already holds Params.BucketSize points).
+// Policies are called concurrently for different tables and must be safe for such use.
+type OverflowPolicy interface {
+	// Overflow is called when the index-th point of the data hashes to the full bucket
+	// with the given key in table t. The policy may modify the buckets of the table.
+	// Returns the key of the bucket in which the point was stored (if stored is true;
+	// no bucket is modified otherwise) and the indices of the points displaced from
+	// the table (including index if it was not stored). Note that "" is a valid key.
+	Overflow(knn *LSHBasedKNN, t int, key string, index int) (changed string, stored bool, displaced []int)
+}
+
+// OverflowStats summarizes the effect of bucket overflows on the tables
+type OverflowStats struct {
+	NumOverflows int // number of times a point hashed to a full bucket (across all tables)
+	NumDisplaced int // number of times a point was left out of (or evicted from) a table
+	NumMissing   int // number of points that are not stored in any table
+}
+
+// DropNewPolicy keeps the points that are already in a full bucket
+// and drops the new point (the default policy)
+type DropNewPolicy struct{}
+
+// LowestBidPolicy keeps the points with the highest bids in each bucket:
+// a new point replaces the point with the lowest bid if its own bid is higher
+type LowestBidPolicy struct {
+	Bids []float64 // bid of each point in the data (0 for points beyond the end)
+}
+
+// ReservoirPolicy keeps a uniformly random sample of
+// all the points that hash to each bucket (reservoir sampling)
+type ReservoirPolicy struct {
+	seed   int64
+	mu     sync.Mutex         // guards tables (each table is sampled independently)
+	tables map[int]*reservoir // sampling state of each table
+}
+
+// reservoir is the sampling state of a table
+type reservoir struct {
+	rng  *rand.Rand     // derived from the seed of the policy and the table index
+	seen map[string]int // number of points hashed to each full bucket
+}
+
+// SpillPolicy stores the point in the first bucket with room among the next
+// MaxProbes buckets that a query for the point retrieves (see LSHBasedKNN.ProbedBuckets).
+// Queries that probe several buckets are likely to find spilled points
+// since near neighbors probe the same sequence of buckets.
+type SpillPolicy struct {
+	MaxProbes int // all the other buckets retrieved by queries if 0
+}
+
+// ParseOverflowPolicy returns the overflow policy with the given name (one of "drop",
+// "reservoir", or "spill"). Reservoir sampling uses params.Seed and spilled points are
+// stored within the buckets probed by queries (see SpillPolicy).
+// Bid-based policies require the bids of the points (see LowestBidPolicy).
+func ParseOverflowPolicy(name string, params *LSHParams) (OverflowPolicy, error) {
+	switch name {
+	case "drop":
+		return DropNewPolicy{}, nil
+	case "reservoir":
+		return NewReservoirPolicy(params.Seed), nil
+	case "spill":
+		return &SpillPolicy{}, nil
+	default:
+		return nil, errors.New("unknown overflow policy " + name)
+	}
+}
+
+// Overflow drops the new point
+func (p DropNewPolicy) Overflow(knn *LSHBasedKNN, t int, key string, index int) (string, bool, []int) {
+	return "", false, []int{index}
+}
+
+// bid returns the bid of the index-th point
+func (p *LowestBidPolicy) bid(index int) float64 {
+	if index < len(p.Bids) {
+		return p.Bids[index]
+	}
+	return 0
+}
+
+// Overflow replaces the lowest bid in the bucket if the bid of the new point is higher
+func (p *LowestBidPolicy) Overflow(knn *LSHBasedKNN, t int, key string, index int) (string, bool, []int) {
+
+	bucket := knn.Tables[t].Buckets[key]
+
+	lowest := -1
+	for i := range bucket {
+		// ties are broken by evicting the most recently added point
+		if lowest < 0 || p.bid(i) < p.bid(lowest) || (p.bid(i) == p.bid(lowest) && i > lowest) {
+			lowest = i
+		}
+	}
+
+	if lowest < 0 || p.bid(index) <= p.bid(lowest) {
+		return "", false, []int{index}
+	}
+
+	delete(bucket, lowest)
+	bucket[index] = true
+
+	return key, true, []int{lowest}
+}
+
+// NewReservoirPolicy returns a reservoir sampling policy that samples using the seed.
+// Each table samples from its own source derived from the seed so that the
+// sample does not depend on the order in which tables are populated.
+func NewReservoirPolicy(seed int64) *ReservoirPolicy {
+	return &ReservoirPolicy{
+		seed:   seed,
+		tables: make(map[int]*reservoir),
+	}
+}
+
+// table returns the sampling state of table t
+func (p *ReservoirPolicy) table(t int) *reservoir {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	r, ok := p.tables[t]
+	if !ok {
+		r = &reservoir{
+			rng:  rand.New(rand.NewSource(tableSeed(p.seed, t))),
+			seen: make(map[string]int),
+		}
+		p.tables[t] = r
+	}
+
+	return r
+}
+
+// tableSeed derives the seed of table t from seed (using the SplitMix64 finalizer)
+func tableSeed(seed int64, t int) int64 {
+	z := uint64(seed) + uint64(t+1)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return int64(z ^ (z >> 31))
+}
+
+// Overflow replaces a random point in the bucket with probability
+// BucketSize / n where n is the number of points that hashed to the bucket.
+// Points of the same table must not overflow concurrently.
+func (p *ReservoirPolicy) Overflow(knn *LSHBasedKNN, t int, key string, index int) (string, bool, []int) {
+
+	bucket := knn.Tables[t].Buckets[key]
+	r := p.table(t)
+
+	n, ok := r.seen[key]
+	if !ok || n < len(bucket) {
+		n = len(bucket)
+	}
+	n++ // the new point is the n-th point hashed to the bucket
+	r.seen[key] = n
+
+	j := r.rng.Intn(n)
+	if j >= len(bucket) {
+		return "", false, []int{index}
+	}
+
+	// map iteration order is random; evict deterministically given j
+	members := make([]int, 0, len(bucket))
+	for i := range bucket {
+		members = append(members, i)
+	}
+	sort.Ints(members)
+
+	evicted := members[j]
+	delete(bucket, evicted)
+	bucket[index] = true
+
+	return key, true, []int{evicted}
+}
+
+// Overflow stores the new point in the next bucket of its probing sequence that has room
+func (p *SpillPolicy) Overflow(knn *LSHBasedKNN, t int, key string, index int) (string, bool, []int) {
+
+	table := knn.Tables[t]
+
+	// the first probe is the full bucket itself
+	probes := knn.ProbedBuckets(t, knn.Data[index])[1:]
+	if p.MaxProbes > 0 && p.MaxProbes < len(probes) {
+		probes = probes[:p.MaxProbes]
+	}
+
+	for _, spillKey := range probes {
+		bucket, ok := table.Buckets[spillKey]
+		if !ok {
+			table.Buckets[spillKey] = map[int]bool{index: true}
+			return spillKey, true, nil
+		}
+
+		if len(bucket) < knn.Params.BucketSize {
+			bucket[index] = true
+			return spillKey, true, nil
+		}
+	}
+
+	return "", false, []int{index}
+}
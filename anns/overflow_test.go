@@ -0,0 +1,267 @@
+package anns
+
+import (
+	"testing"
+
+	"github.com/sachaservan/vec"
+)
+
+// getTestCollidingData returns n copies of the same point
+// (which hash to the same bucket in every table)
+func getTestCollidingData(n, dim int) []*vec.Vec {
+	v := vec.NewRandomVec(dim, -50, 50)
+	data := make([]*vec.Vec, n)
+	for i := range data {
+		data[i] = v.Copy()
+	}
+	return data
+}
+
+func TestDropNewPolicy(t *testing.T) {
+	params := getTestParams()
+	knn, err := NewLSHBased(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := getTestCollidingData(10, params.NumFeatures)
+	_, err = knn.BuildWithData(data, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats := knn.OverflowStats()
+	if stats.NumOverflows != 9*params.NumTables || stats.NumDisplaced != 9*params.NumTables {
+		t.Fatalf("unexpected overflow stats %+v", stats)
+	}
+
+	if stats.NumMissing != 9 {
+		t.Fatalf("%v points are missing, expected 9", stats.NumMissing)
+	}
+}
+
+func TestLowestBidPolicy(t *testing.T) {
+	params := getTestParams()
+	knn, err := NewLSHBased(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := getTestCollidingData(10, params.NumFeatures)
+	bids := []float64{5, 1, 9, 3, 7, 2, 8, 0, 4, 6}
+	knn.OverflowPolicy = &LowestBidPolicy{Bids: bids}
+
+	_, err = knn.BuildWithData(data, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for tableIndex, table := range knn.Tables {
+		for _, bucket := range table.Buckets {
+			if len(bucket) != 2 || !bucket[2] || !bucket[6] {
+				t.Fatalf("table %v does not keep the highest bids: %v", tableIndex, bucket)
+			}
+		}
+	}
+}
+
+func TestReservoirPolicy(t *testing.T) {
+	params := getTestParams()
+	knn, err := NewLSHBased(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := getTestCollidingData(100, params.NumFeatures)
+	knn.OverflowPolicy = NewReservoirPolicy(1)
+
+	_, err = knn.BuildWithData(data, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for tableIndex, table := range knn.Tables {
+		for _, bucket := range table.Buckets {
+			if len(bucket) != 3 {
+				t.Fatalf("bucket in table %v has %v != 3 points", tableIndex, len(bucket))
+			}
+		}
+	}
+
+	stats := knn.OverflowStats()
+	if stats.NumDisplaced != 97*params.NumTables {
+		t.Fatalf("unexpected overflow stats %+v", stats)
+	}
+}
+
+func TestReservoirPolicyDeterministic(t *testing.T) {
+	params := getTestParams()
+	params.Seed = 1
+	data := getTestCollidingData(100, params.NumFeatures)
+
+	// tables are populated concurrently; the samples must not depend on the schedule
+	var expected map[int]*Table
+	for trial := 0; trial < 10; trial++ {
+		knn, err := NewLSHBased(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		knn.OverflowPolicy = NewReservoirPolicy(params.Seed)
+
+		_, err = knn.BuildWithData(data, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected == nil {
+			expected = knn.Tables
+			continue
+		}
+
+		for tableIndex, table := range knn.Tables {
+			for key, bucket := range table.Buckets {
+				for i := range bucket {
+					if !expected[tableIndex].Buckets[key][i] {
+						t.Fatalf("table %v differs between builds with the same seed", tableIndex)
+					}
+				}
+			}
+		}
+	}
+
+	// tables sample independently
+	r0 := NewReservoirPolicy(1).table(0).rng.Int63()
+	r1 := NewReservoirPolicy(1).table(1).rng.Int63()
+	if r0 == r1 {
+		t.Fatalf("tables sample from the same source")
+	}
+}
+
+func TestSpillPolicy(t *testing.T) {
+	params := getTestParams()
+	params.NumProbes = 4
+	knn, err := NewLSHBased(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := getTestCollidingData(10, params.NumFeatures)
+	knn.OverflowPolicy = &SpillPolicy{MaxProbes: 3}
+
+	_, err = knn.BuildWithData(data, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first point plus three spilled points in each table
+	stats := knn.OverflowStats()
+	if stats.NumDisplaced != 6*params.NumTables || stats.NumMissing != 6 {
+		t.Fatalf("unexpected overflow stats %+v", stats)
+	}
+
+	// spilled points are found by probing the same sequence of buckets
+	if len(knn.Candidates(data[0])) != 4 {
+		t.Fatalf("expected 4 candidates, got %v", len(knn.Candidates(data[0])))
+	}
+
+	// spilled points can be deleted
+	_, err = knn.Delete(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(knn.Candidates(data[0])) != 3 {
+		t.Fatalf("deleted spilled point is still a candidate")
+	}
+}
+
+func TestSpillPolicyPartitions(t *testing.T) {
+	params := getTestParams()
+	params.NumProbes = 3
+	params.NumBuckets = PartitionedNumBuckets(30, params.NumProbes, 1)
+	knn, err := NewLSHBased(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := getTestCollidingData(10, params.NumFeatures)
+	knn.OverflowPolicy = &SpillPolicy{}
+
+	_, err = knn.BuildWithData(data, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	partitionSize := params.NumBuckets / params.NumProbes
+	for tableIndex, table := range knn.Tables {
+		retrieved := make(map[string]bool)
+		for partition, index := range knn.Hashes[tableIndex].PartitionProbes(data[0], params.NumProbes, partitionSize) {
+			retrieved[BucketKey(int64(partition*partitionSize)+index)] = true
+		}
+
+		for key, bucket := range table.Buckets {
+			if len(bucket) == 0 {
+				t.Fatalf("table %v has an empty bucket", tableIndex)
+			}
+
+			if !retrieved[key] {
+				t.Fatalf("point is spilled into a bucket that is not retrieved")
+			}
+		}
+	}
+
+	// each query retrieves one bucket per partition
+	candidates, _, _ := knn.RetrieveBuckets(data[0])
+	if len(candidates) != params.NumProbes {
+		t.Fatalf("expected %v candidates, got %v", params.NumProbes, len(candidates))
+	}
+}
+
+func TestOverflowZeroDigest(t *testing.T) {
+	params := &LSHParams{
+		NumFeatures:    8,
+		NumTables:      3,
+		NumProbes:      1,
+		NumProjections: 1,
+		Metric:         HammingDistance,
+	}
+
+	knn, err := NewLSHBased(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	knn.OverflowPolicy = &LowestBidPolicy{Bids: []float64{1, 2, 3}}
+
+	// the zero vector hashes to the bucket with the empty key in every table
+	zero := vec.NewVec(make([]float64, params.NumFeatures))
+	_, err = knn.BuildWithData([]*vec.Vec{zero, zero.Copy()}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, affected, err := knn.Insert(zero.Copy())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for tableIndex := range knn.Tables {
+		if len(affected[tableIndex]) != 1 || affected[tableIndex][0] != "" {
+			t.Fatalf("insert into the full zero bucket of table %v is not reported", tableIndex)
+		}
+	}
+
+	for _, index := range []int{2, 1} {
+		if _, err := knn.Delete(index); err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := knn.QueryIndices(zero, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(res) != 0 {
+			t.Fatalf("deleted point %v is still returned: %v", index, res)
+		}
+	}
+}
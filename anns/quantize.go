@@ -0,0 +1,110 @@
+package anns
+
+import (
+	"errors"
+	"math"
+
+	"github.com/sachaservan/vec"
+)
+
+// Quantizer maps each coordinate of a vector to an int8 using a per-dimension
+// scale and offset: coordinate i of v is approximated by Offset[i] + Scale[i] * q[i]
+// where q[i] is in the range [-128, 127]
+type Quantizer struct {
+	Scale  []float64
+	Offset []float64
+}
+
+// NewQuantizer returns a quantizer that covers the range of
+// each coordinate over the (non-nil) vectors in data
+func NewQuantizer(data []*vec.Vec) (*Quantizer, error) {
+
+	dim := -1
+	for _, v := range data {
+		if v != nil {
+			dim = v.Size()
+			break
+		}
+	}
+
+	if dim < 0 {
+		return nil, errors.New("quantization requires data")
+	}
+
+	min := make([]float64, dim)
+	max := make([]float64, dim)
+	for i := range min {
+		min[i] = math.Inf(1)
+		max[i] = math.Inf(-1)
+	}
+
+	for _, v := range data {
+		if v == nil {
+			continue
+		}
+
+		if v.Size() != dim {
+			return nil, errors.New("vectors have different dimensions")
+		}
+
+		for i, c := range v.Coords {
+			min[i] = math.Min(min[i], c)
+			max[i] = math.Max(max[i], c)
+		}
+	}
+
+	q := &Quantizer{
+		Scale:  make([]float64, dim),
+		Offset: make([]float64, dim),
+	}
+
+	for i := range q.Scale {
+		// the range [min, max] is split into 256 levels
+		q.Scale[i] = (max[i] - min[i]) / 255
+		if q.Scale[i] == 0 {
+			// constant coordinate
+			q.Scale[i] = 1
+		}
+		q.Offset[i] = min[i] + 128*q.Scale[i]
+	}
+
+	return q, nil
+}
+
+// Dim returns the dimension of the vectors handled by the quantizer
+func (q *Quantizer) Dim() int {
+	return len(q.Scale)
+}
+
+// Quantize returns the int8 encoding of v; coordinates outside
+// the range of the quantizer are clamped to the nearest level
+func (q *Quantizer) Quantize(v *vec.Vec) ([]int8, error) {
+
+	if v.Size() != q.Dim() {
+		return nil, errors.New("vector dimension does not match the quantizer")
+	}
+
+	res := make([]int8, v.Size())
+	for i, c := range v.Coords {
+		level := math.Round((c - q.Offset[i]) / q.Scale[i])
+		level = math.Max(math.MinInt8, math.Min(math.MaxInt8, level))
+		res[i] = int8(level)
+	}
+
+	return res, nil
+}
+
+// Dequantize returns the vector approximated by the int8 encoding
+func (q *Quantizer) Dequantize(levels []int8) (*vec.Vec, error) {
+
+	if len(levels) != q.Dim() {
+		return nil, errors.New("encoding dimension does not match the quantizer")
+	}
+
+	coords := make([]float64, len(levels))
+	for i, level := range levels {
+		coords[i] = q.Offset[i] + q.Scale[i]*float64(level)
+	}
+
+	return vec.NewVec(coords), nil
+}
@@ -0,0 +1,61 @@
+package anns
+
+import (
+	"math"
+	"testing"
+
+	"github.com/sachaservan/vec"
+)
+
+func TestQuantizeError(t *testing.T) {
+	data := getTestData(100, 10)
+
+	q, err := NewQuantizer(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range data {
+		levels, err := q.Quantize(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := q.Dequantize(levels)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := range v.Coords {
+			if math.Abs(res.Coords[i]-v.Coords[i]) > q.Scale[i]/2+1e-9 {
+				t.Fatalf("coordinate %v dequantized to %v, expected %v", i, res.Coords[i], v.Coords[i])
+			}
+		}
+	}
+}
+
+func TestQuantizeClamps(t *testing.T) {
+	q, err := NewQuantizer([]*vec.Vec{vec.NewVec([]float64{0, 5}), vec.NewVec([]float64{1, 5})})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	levels, err := q.Quantize(vec.NewVec([]float64{-10, 5}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if levels[0] != math.MinInt8 {
+		t.Fatalf("out of range coordinate was not clamped: %v", levels[0])
+	}
+
+	res, err := q.Dequantize(levels)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// binary and constant coordinates are recovered exactly
+	if math.Abs(res.Coords[0]) > 1e-9 || math.Abs(res.Coords[1]-5) > 1e-9 {
+		t.Fatalf("expected (0, 5), got %v", res.Coords)
+	}
+}
@@ -0,0 +1,116 @@
+package anns
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"io"
+
+	"github.com/sachaservan/vec"
+)
+
+// SnapshotVersion is the version of the snapshot format written by WriteSnapshot.
+// Snapshots with a different version are rejected by ReadSnapshot.
+const SnapshotVersion = 1
+
+// snapshotMagic identifies a snapshot of an LSH-based data structure
+var snapshotMagic = []byte("ADVEILLSH")
+
+// Snapshot is a serializable copy of a built LSH-based data structure.
+// The hash types used in the tables must be registered with gob.
+type Snapshot struct {
+	Version int
+	Params  *LSHParams
+	Data    []*vec.Vec
+	Deleted []int // indices of deleted points (see Delete)
+	Tables  map[int]*Table
+	Hashes  map[int]*LSH
+}
+
+// Snapshot returns a snapshot of the data structure
+func (knn *LSHBasedKNN) Snapshot() *Snapshot {
+
+	s := &Snapshot{
+		Version: SnapshotVersion,
+		Params:  knn.Params,
+		Data:    knn.Data,
+		Tables:  knn.Tables,
+		Hashes:  knn.Hashes,
+	}
+
+	// gob cannot encode the nil entries of deleted points
+	for i, v := range knn.Data {
+		if v == nil {
+			if s.Deleted == nil {
+				s.Data = make([]*vec.Vec, len(knn.Data))
+				copy(s.Data, knn.Data)
+			}
+			s.Data[i] = vec.NewVec([]float64{})
+			s.Deleted = append(s.Deleted, i)
+		}
+	}
+
+	return s
+}
+
+// Restore returns the data structure captured by the snapshot
+func (s *Snapshot) Restore() (*LSHBasedKNN, error) {
+
+	if s.Version != SnapshotVersion {
+		return nil, errors.New("unsupported snapshot version")
+	}
+
+	if s.Params == nil || len(s.Hashes) != s.Params.NumTables {
+		return nil, errors.New("snapshot is missing hash functions")
+	}
+
+	tables := s.Tables
+	if tables == nil {
+		tables = make(map[int]*Table)
+	}
+
+	data := s.Data
+	for _, i := range s.Deleted {
+		if i < 0 || i >= len(data) {
+			return nil, errors.New("snapshot deletes a missing point")
+		}
+		data[i] = nil
+	}
+
+	return &LSHBasedKNN{
+		Params: s.Params,
+		Data:   data,
+		Tables: tables,
+		Hashes: s.Hashes,
+	}, nil
+}
+
+// WriteSnapshot writes a versioned snapshot of the data structure to w
+func (knn *LSHBasedKNN) WriteSnapshot(w io.Writer) error {
+
+	if _, err := w.Write(snapshotMagic); err != nil {
+		return err
+	}
+
+	return gob.NewEncoder(w).Encode(knn.Snapshot())
+}
+
+// ReadSnapshot reads a data structure from a snapshot written by WriteSnapshot
+func ReadSnapshot(r io.Reader) (*LSHBasedKNN, error) {
+
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(magic, snapshotMagic) {
+		return nil, errors.New("not an LSH snapshot")
+	}
+
+	s := &Snapshot{}
+	if err := gob.NewDecoder(r).Decode(s); err != nil {
+		return nil, err
+	}
+
+	return s.Restore()
+}
@@ -0,0 +1,84 @@
+package anns
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	params := getTestParams()
+	params.NumBuckets = 100
+	params.HashBytes = 4
+
+	knn, err := NewLSHBased(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := getTestData(500, params.NumFeatures)
+	_, err = knn.BuildWithData(data, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = knn.Delete(len(data) - 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	err = knn.WriteSnapshot(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := ReadSnapshot(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if restored.Data[len(data)-1] != nil {
+		t.Fatalf("deleted point was restored")
+	}
+
+	for i := 0; i < 10; i++ {
+		expected, err := knn.QueryIndices(data[i], 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := restored.QueryIndices(data[i], 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(res) != len(expected) {
+			t.Fatalf("restored data structure returned %v results, expected %v", len(res), len(expected))
+		}
+
+		for j := range res {
+			if res[j] != expected[j] {
+				t.Fatalf("restored data structure returned different results")
+			}
+		}
+	}
+}
+
+func TestSnapshotRejectsVersion(t *testing.T) {
+	params := getTestParams()
+	knn, err := NewLSHBased(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := knn.Snapshot()
+	s.Version = SnapshotVersion + 1
+	if _, err := s.Restore(); err == nil {
+		t.Fatalf("restored a snapshot with an unsupported version")
+	}
+
+	_, err = ReadSnapshot(bytes.NewReader([]byte("not a snapshot")))
+	if err == nil {
+		t.Fatalf("read a snapshot with an invalid header")
+	}
+}
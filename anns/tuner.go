@@ -0,0 +1,250 @@
+package anns
+
+import (
+	"errors"
+	"math"
+	"sort"
+
+	"github.com/sachaservan/vec"
+)
+
+// PIRCostModel estimates the cost of privately querying the hash tables.
+// Each table is split into NumProbes databases (one PIR query each) and the
+// server processes every byte of every table to answer the queries.
+// Buckets are serialized with EncodeQuantizedBucket.
+type PIRCostModel struct {
+	NumBuckets          int     // number of buckets in each hash table (before partitioning)
+	NumPoints           int     // number of points stored in the tables (the sample size if 0)
+	NumParallel         int     // parallelism of each database (see PartitionedNumBuckets)
+	BucketOverheadBytes int     // bytes added to each serialized bucket (e.g., proofs)
+	QueryCost           float64 // cost of each PIR query (e.g., query + answer bytes)
+	ByteCost            float64 // cost of processing each byte of the table databases
+}
+
+// TuningSpace specifies the parameter values searched over by the tuner
+type TuningSpace struct {
+	NumTables        []int
+	NumProjections   []int
+	ProjectionWidths []float64
+	NumProbes        []int
+}
+
+// TuningResult is the outcome of tuning the LSH parameters
+type TuningResult struct {
+	Params *LSHParams
+	Recall float64 // recall@k of the tuned parameters on the sample queries
+	Cost   float64 // estimated PIR cost of the tuned parameters
+}
+
+// TableBuckets returns the number of buckets in each
+// hash table when it is split into numProbes partitions
+func (m *PIRCostModel) TableBuckets(numProbes int) int {
+	return PartitionedNumBuckets(m.NumBuckets, numProbes, m.NumParallel)
+}
+
+// SampleBuckets returns the number of buckets of each table built over
+// sampleSize points (split into numProbes partitions) such that buckets
+// hold as many points on average as in the tables of the cost model
+func (m *PIRCostModel) SampleBuckets(numProbes, sampleSize int) int {
+
+	numBuckets := m.NumBuckets
+	if m.NumPoints > sampleSize {
+		numBuckets = int(math.Ceil(float64(m.NumBuckets) * float64(sampleSize) / float64(m.NumPoints)))
+	}
+
+	// padding the partitions for parallelism would change the load of small tables
+	return PartitionedNumBuckets(numBuckets, numProbes, 1)
+}
+
+// Cost returns the estimated cost of querying tables built with params
+func (m *PIRCostModel) Cost(params *LSHParams) float64 {
+
+	numDBs := params.NumTables * params.NumProbes
+	bucketBytes := QuantizedBucketBytes(params.NumFeatures, params.BucketSize) + m.BucketOverheadBytes
+	tableBytes := float64(params.NumTables) * float64(m.TableBuckets(params.NumProbes)) * float64(bucketBytes)
+
+	return float64(numDBs)*m.QueryCost + tableBytes*m.ByteCost
+}
+
+// DefaultTuningSpace returns a tuning space covering typical parameters
+func DefaultTuningSpace() *TuningSpace {
+	return &TuningSpace{
+		NumTables:        []int{1, 2, 4, 5, 8, 16},
+		NumProjections:   []int{2, 5, 10, 20, 50},
+		ProjectionWidths: []float64{5, 10, 20, 50, 100, 300},
+		NumProbes:        []int{1, 5, 10, 15},
+	}
+}
+
+// BruteForceKNN returns the indices of the k closest points in data
+// to query according to the distance function dist (nil points are skipped)
+func BruteForceKNN(data []*vec.Vec, query *vec.Vec, k int, dist DistanceFunction) []int {
+
+	distances := make([]float64, len(data))
+	indices := make([]int, 0, len(data))
+	for i, v := range data {
+		if v == nil {
+			// deleted point
+			continue
+		}
+		distances[i] = dist(query, v)
+		indices = append(indices, i)
+	}
+
+	sort.SliceStable(indices, func(i, j int) bool {
+		return distances[indices[i]] < distances[indices[j]]
+	})
+
+	if k < len(indices) {
+		indices = indices[:k]
+	}
+
+	return indices
+}
+
+// Recall returns the fraction of exact neighbors found by the approximate query
+func Recall(approx, exact []int) float64 {
+
+	if len(exact) == 0 {
+		return 1
+	}
+
+	found := make(map[int]bool)
+	for _, i := range approx {
+		found[i] = true
+	}
+
+	hits := 0
+	for _, i := range exact {
+		if found[i] {
+			hits++
+		}
+	}
+
+	return float64(hits) / float64(len(exact))
+}
+
+// Tune searches over the parameters in space for the parameters that achieve
+// (average) recall@k of at least targetRecall on the queries over the data,
+// at the lowest cost according to the cost model.
+// Recall is measured on the buckets that clients retrieve (see RetrieveBuckets)
+// from tables compressed to the number of buckets of the cost model, scaled
+// down to the sample data (see SampleBuckets).
+// Projection widths are only searched for the Euclidean distance and multiple
+// probes only for metrics that support multiprobing (see SupportsMultiProbe).
+// All other parameters (features, metric, bucket size) are copied from base.
+func Tune(
+	base *LSHParams,
+	data []*vec.Vec,
+	queries []*vec.Vec,
+	k int,
+	targetRecall float64,
+	model *PIRCostModel,
+	space *TuningSpace) (*TuningResult, error) {
+
+	if len(data) == 0 || len(queries) == 0 {
+		return nil, errors.New("tuning requires sample data and queries")
+	}
+
+	if model.NumBuckets < 1 {
+		return nil, errors.New("tuning requires the number of buckets of the tables")
+	}
+
+	for _, q := range queries {
+		if q.Size() != base.NumFeatures {
+			return nil, errors.New("query dimension does not match the number of features")
+		}
+	}
+
+	// the width only applies to the hashes of the euclidean distance
+	widths := space.ProjectionWidths
+	if base.Metric != EuclideanDistance {
+		widths = []float64{base.ProjectionWidth}
+	}
+
+	probes := space.NumProbes
+	if !SupportsMultiProbe(base.Metric) {
+		probes = []int{1}
+	}
+
+	candidates := make([]*LSHParams, 0)
+	for _, numTables := range space.NumTables {
+		for _, numProjections := range space.NumProjections {
+			for _, width := range widths {
+				for _, numProbes := range probes {
+					params := *base
+					params.NumTables = numTables
+					params.NumProjections = numProjections
+					params.ProjectionWidth = width
+					params.NumProbes = numProbes
+
+					params.NumBuckets = model.TableBuckets(numProbes)
+
+					candidates = append(candidates, &params)
+				}
+			}
+		}
+	}
+
+	// the first candidate (by cost) that meets the target recall is optimal
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return model.Cost(candidates[i]) < model.Cost(candidates[j])
+	})
+
+	dist := MetricDistance(base.Metric)
+	exact := make([][]int, len(queries))
+	for i, q := range queries {
+		exact[i] = BruteForceKNN(data, q, k, dist)
+	}
+
+	// the tables only depend on the number of probes through the
+	// number of buckets so the data structure is reused across candidates
+	type buildKey struct {
+		numTables      int
+		numProjections int
+		width          float64
+		numBuckets     int
+	}
+	built := make(map[buildKey]*LSHBasedKNN)
+
+	for _, params := range candidates {
+		numBuckets := model.SampleBuckets(params.NumProbes, len(data))
+		key := buildKey{params.NumTables, params.NumProjections, params.ProjectionWidth, numBuckets}
+		knn, ok := built[key]
+		if !ok {
+			var err error
+			buildParams := *params
+			buildParams.NumBuckets = numBuckets
+			knn, err = NewLSHBased(&buildParams)
+			if err != nil {
+				return nil, err
+			}
+
+			_, err = knn.BuildWithData(data, params.BucketSize)
+			if err != nil {
+				return nil, err
+			}
+
+			built[key] = knn
+		}
+
+		knn.Params.NumProbes = params.NumProbes
+
+		recall := 0.0
+		for i, q := range queries {
+			candidates, _, _ := knn.RetrieveBuckets(q)
+			recall += Recall(knn.Rank(q, candidates, k), exact[i])
+		}
+		recall /= float64(len(queries))
+
+		if recall >= targetRecall {
+			return &TuningResult{
+				Params: params,
+				Recall: recall,
+				Cost:   model.Cost(params),
+			}, nil
+		}
+	}
+
+	return nil, errors.New("no parameters in the tuning space achieve the target recall")
+}
@@ -0,0 +1,156 @@
+package anns
+
+import (
+	"testing"
+
+	"github.com/sachaservan/vec"
+)
+
+func getTestCostModel() *PIRCostModel {
+	return &PIRCostModel{
+		NumBuckets:  1000,
+		NumParallel: 4,
+		QueryCost:   1 << 16,
+		ByteCost:    1,
+	}
+}
+
+func getTestQueries(data []*vec.Vec, n int) []*vec.Vec {
+	queries := make([]*vec.Vec, n)
+	for i := range queries {
+		queries[i] = data[i].Copy()
+		queries[i].Add(vec.NewRandomVec(data[i].Size(), -2, 2))
+	}
+	return queries
+}
+
+func TestTune(t *testing.T) {
+	base := getTestParams()
+	base.BucketSize = 10
+
+	data := getTestData(500, base.NumFeatures)
+	queries := getTestQueries(data, 20)
+
+	space := &TuningSpace{
+		NumTables:        []int{1, 2, 4},
+		NumProjections:   []int{2, 4},
+		ProjectionWidths: []float64{10, 50},
+		NumProbes:        []int{1, 5},
+	}
+
+	model := getTestCostModel()
+	res, err := Tune(base, data, queries, 1, 0.5, model, space)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Recall < 0.5 {
+		t.Fatalf("tuned parameters have recall %v < 0.5", res.Recall)
+	}
+
+	if res.Cost != model.Cost(res.Params) {
+		t.Fatalf("reported cost does not match the cost of the parameters")
+	}
+
+	if res.Params.NumFeatures != base.NumFeatures || res.Params.BucketSize != base.BucketSize {
+		t.Fatalf("tuned parameters do not preserve the base parameters")
+	}
+
+	if res.Params.NumBuckets != model.TableBuckets(res.Params.NumProbes) {
+		t.Fatalf("tuned parameters have %v buckets, expected %v",
+			res.Params.NumBuckets, model.TableBuckets(res.Params.NumProbes))
+	}
+}
+
+func TestTuneMetricSpace(t *testing.T) {
+	base := &LSHParams{
+		NumFeatures: 20,
+		BucketSize:  10,
+		Metric:      JaccardDistance,
+	}
+
+	data := make([]*vec.Vec, 200)
+	for i := range data {
+		data[i] = vec.NewRandomVec(base.NumFeatures, 0, 1)
+		for j := range data[i].Coords {
+			data[i].Coords[j] = float64(int(data[i].Coords[j] + 0.5))
+		}
+	}
+
+	space := &TuningSpace{
+		NumTables:        []int{1, 2, 4},
+		NumProjections:   []int{1, 2},
+		ProjectionWidths: []float64{10, 50},
+		NumProbes:        []int{5},
+	}
+
+	// minhash does not support multiprobing and has no width
+	res, err := Tune(base, data, data[:10], 1, 0.5, getTestCostModel(), space)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Params.NumProbes != 1 || res.Params.ProjectionWidth != base.ProjectionWidth {
+		t.Fatalf("tuned parameters %+v are outside the space of the metric", res.Params)
+	}
+}
+
+func TestSampleBuckets(t *testing.T) {
+	model := getTestCostModel()
+
+	// a tenth of the points in a tenth of the buckets
+	model.NumPoints = 10000
+	if model.SampleBuckets(1, 1000) != 100 || model.SampleBuckets(3, 1000) != 102 {
+		t.Fatalf("sample buckets are not scaled to the sample size")
+	}
+
+	// all points are sampled
+	model.NumPoints = 0
+	if model.SampleBuckets(1, 1000) != model.NumBuckets {
+		t.Fatalf("expected %v buckets, got %v", model.NumBuckets, model.SampleBuckets(1, 1000))
+	}
+}
+
+func TestPartitionedNumBuckets(t *testing.T) {
+	tests := []struct {
+		numBuckets, numProbes, numParallel, expected int
+	}{
+		{1000, 1, 1, 1000},
+		{1000, 3, 1, 1002},
+		{1000, 1, 8, 1000},
+		{1000, 3, 8, 1008},
+		{10, 4, 0, 12},
+	}
+
+	for _, test := range tests {
+		res := PartitionedNumBuckets(test.numBuckets, test.numProbes, test.numParallel)
+		if res != test.expected {
+			t.Fatalf("PartitionedNumBuckets(%v, %v, %v) = %v, expected %v",
+				test.numBuckets, test.numProbes, test.numParallel, res, test.expected)
+		}
+	}
+}
+
+func TestTuneUnreachableRecall(t *testing.T) {
+	base := getTestParams()
+	data := getTestData(100, base.NumFeatures)
+	queries := getTestQueries(data, 5)
+
+	space := &TuningSpace{
+		NumTables:        []int{1},
+		NumProjections:   []int{50},
+		ProjectionWidths: []float64{1},
+		NumProbes:        []int{1},
+	}
+
+	_, err := Tune(base, data, queries, 10, 1.0, getTestCostModel(), space)
+	if err == nil {
+		t.Fatalf("expected tuning to fail for an unreachable recall")
+	}
+}
+
+func TestRecall(t *testing.T) {
+	if Recall([]int{1, 2, 3}, []int{3, 4}) != 0.5 {
+		t.Fatalf("wrong recall")
+	}
+}
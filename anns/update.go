@@ -0,0 +1,125 @@
+package anns
+
+import (
+	"errors"
+
+	"github.com/sachaservan/vec"
+)
+
+// Insert adds v to the data and hashes it into the buckets of each table.
+// As in BuildWithData, the OverflowPolicy applies to tables where its bucket is full.
+// Returns the index of v in the data and the keys of the buckets
+// that changed in each table.
+func (knn *LSHBasedKNN) Insert(v *vec.Vec) (int, map[int][]string, error) {
+
+	if v.Size() != knn.Params.NumFeatures {
+		return 0, nil, errors.New("data point dimension does not match the number of features")
+	}
+
+	index := len(knn.Data)
+	knn.Data = append(knn.Data, v)
+
+	return index, knn.addToTables(index), nil
+}
+
+// Delete removes the index-th point from the buckets of each table.
+// Indices of the other points are unchanged; the point is
+// replaced by nil in the data and is never returned by queries.
+// Returns the keys of the buckets that changed in each table.
+func (knn *LSHBasedKNN) Delete(index int) (map[int][]string, error) {
+
+	if index < 0 || index >= len(knn.Data) || knn.Data[index] == nil {
+		return nil, errors.New("no data point with the given index")
+	}
+
+	affected := knn.removeFromTables(index)
+	knn.Data[index] = nil
+
+	return affected, nil
+}
+
+// Update replaces the index-th point with v and rehashes it into the buckets
+// of each table. Returns the keys of the buckets that changed in each table.
+func (knn *LSHBasedKNN) Update(index int, v *vec.Vec) (map[int][]string, error) {
+
+	if v.Size() != knn.Params.NumFeatures {
+		return nil, errors.New("data point dimension does not match the number of features")
+	}
+
+	if index < 0 || index >= len(knn.Data) || knn.Data[index] == nil {
+		return nil, errors.New("no data point with the given index")
+	}
+
+	affected := knn.removeFromTables(index)
+	knn.Data[index] = v
+
+	for t, keys := range knn.addToTables(index) {
+		for _, key := range keys {
+			if len(affected[t]) == 0 || affected[t][0] != key {
+				affected[t] = append(affected[t], key)
+			}
+		}
+	}
+
+	return affected, nil
+}
+
+// addToTables hashes the index-th point into the buckets of each table
+func (knn *LSHBasedKNN) addToTables(index int) map[int][]string {
+
+	affected := make(map[int][]string)
+	for t := 0; t < knn.Params.NumTables; t++ {
+		table, ok := knn.Tables[t]
+		if !ok {
+			table = newTable()
+			knn.Tables[t] = table
+		}
+
+		key := knn.Hashes[t].StringDigest(knn.Data[index])
+		bucket, ok := table.Buckets[key]
+		if !ok {
+			bucket = make(map[int]bool)
+			table.Buckets[key] = bucket
+		}
+
+		if knn.Params.BucketSize > 0 && len(bucket) >= knn.Params.BucketSize {
+			changed, stored, displaced := knn.overflowPolicy().Overflow(knn, t, key, index)
+			table.overflowed(index, changed, stored, displaced)
+			knn.numOverflows++
+			knn.numDisplaced += len(displaced)
+			if stored {
+				affected[t] = []string{changed}
+			}
+			continue
+		}
+
+		table.store(key, bucket, index)
+		affected[t] = []string{key}
+	}
+
+	return affected
+}
+
+// removeFromTables removes the index-th point from the buckets of each table
+func (knn *LSHBasedKNN) removeFromTables(index int) map[int][]string {
+
+	affected := make(map[int][]string)
+	for t, table := range knn.Tables {
+		// the point may be stored in another bucket than its own (see SpillPolicy)
+		// or in none if it overflowed its bucket in this table
+		key, ok := table.keyOf(index)
+		if !ok {
+			continue
+		}
+
+		bucket := table.Buckets[key]
+		delete(bucket, index)
+		delete(table.keys, index)
+		if len(bucket) == 0 {
+			delete(table.Buckets, key)
+		}
+		affected[t] = []string{key}
+	}
+
+	return affected
+}
@@ -0,0 +1,139 @@
+package anns
+
+import (
+	"testing"
+
+	"github.com/sachaservan/vec"
+)
+
+func TestInsertDeleteUpdate(t *testing.T) {
+	params := getTestParams()
+	knn, err := NewLSHBased(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := getTestData(500, params.NumFeatures)
+	_, err = knn.BuildWithData(data, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := vec.NewRandomVec(params.NumFeatures, -50, 50)
+	index, affected, err := knn.Insert(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if index != len(data) || len(affected) != params.NumTables {
+		t.Fatalf("insert returned index %v affecting %v tables", index, len(affected))
+	}
+
+	res, err := knn.QueryIndices(v, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res) != 1 || res[0] != index {
+		t.Fatalf("inserted point is not its own nearest neighbor")
+	}
+
+	// move the point somewhere else
+	w := vec.NewRandomVec(params.NumFeatures, -50, 50)
+	_, err = knn.Update(index, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err = knn.QueryIndices(w, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res) != 1 || res[0] != index {
+		t.Fatalf("updated point is not its own nearest neighbor")
+	}
+
+	affected, err = knn.Delete(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(affected) != params.NumTables {
+		t.Fatalf("delete affected %v tables, expected %v", len(affected), params.NumTables)
+	}
+
+	for _, i := range knn.Candidates(w) {
+		if i == index {
+			t.Fatalf("deleted point is still a candidate")
+		}
+	}
+
+	_, err = knn.Delete(index)
+	if err == nil {
+		t.Fatalf("deleted a point twice")
+	}
+}
+
+func TestInsertFullBucket(t *testing.T) {
+	params := getTestParams()
+	knn, err := NewLSHBased(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := vec.NewRandomVec(params.NumFeatures, -50, 50)
+	_, err = knn.BuildWithData([]*vec.Vec{v}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the same point hashes to the same (full) bucket in every table
+	_, affected, err := knn.Insert(v.Copy())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(affected) != 0 {
+		t.Fatalf("insert into full buckets affected %v tables", len(affected))
+	}
+}
+
+func TestDeleteSpilledPoint(t *testing.T) {
+	params := getTestParams()
+	params.NumProbes = 4
+	knn, err := NewLSHBased(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	knn.OverflowPolicy = &SpillPolicy{MaxProbes: 3}
+
+	// the copy hashes to the same (full) bucket in every table and spills
+	v := vec.NewRandomVec(params.NumFeatures, -50, 50)
+	_, err = knn.BuildWithData([]*vec.Vec{v, v.Copy()}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	affected, err := knn.Delete(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for tableIndex, table := range knn.Tables {
+		key := knn.Hashes[tableIndex].StringDigest(v)
+		if len(affected[tableIndex]) == 1 && affected[tableIndex][0] == key {
+			t.Fatalf("delete of spilled point changed the bucket of the first point")
+		}
+
+		for _, bucket := range table.Buckets {
+			if bucket[1] {
+				t.Fatalf("deleted point is still in table %v", tableIndex)
+			}
+		}
+
+		if !table.Buckets[key][0] {
+			t.Fatalf("first point is missing from table %v", tableIndex)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"github.com/sachaservan/adveil/adstore"
 	"github.com/sachaservan/adveil/anns"
 	"github.com/sachaservan/adveil/sealpir"
 )
@@ -10,20 +11,27 @@ type Error struct {
 	Msg string
 }
 
-// AdQueryArgs arguments to a bucket hash PIR query
+// AdQueryArgs arguments to an ad creative PIR query
 type AdQueryArgs struct {
-	Query *sealpir.Query // private PIR query
-	Index int64          // non-private query
+	Queries map[int][]*sealpir.Query // private PIR queries; one per chunk of each size class
+	Index   int64                    // non-private query (ad ID)
 }
 
-// AdQueryResponse response to a bucket hash PIR query
+// AdQueryResponse response to an ad creative PIR query
 type AdQueryResponse struct {
 	Error              Error
-	Answer             []*sealpir.Answer // private PIR query
-	Item               []byte            // non-private query
+	Answers            map[int][][]*sealpir.Answer // private PIR query
+	Item               []byte                      // non-private query
 	StatsTotalTimeInMS int64
 }
 
+// AuctionReport is the outcome of a client-side auction reported to the broker
+// (the losing candidates are not included)
+type AuctionReport struct {
+	AdID  int
+	Price float64
+}
+
 // BucketQueryArgs arguments to a bucket PIR query
 type BucketQueryArgs struct {
 	Queries map[int]*sealpir.Query // one query per hash table
@@ -40,6 +48,7 @@ type BucketQueryResponse struct {
 // SetKeysArgs for setting SealPIR galois keys
 type SetKeysArgs struct {
 	TableDBGaloisKeys *sealpir.GaloisKeys
+	AdDBGaloisKeys    map[int]*sealpir.GaloisKeys // one for each size class of the ad database
 }
 
 // SetKeysResponse if error occurs
@@ -55,15 +64,25 @@ type InitSessionResponse struct {
 	SessionParameters
 	Error Error
 
-	TableNumBuckets    map[int]int               // number of hash buckets in each table
-	TableHashFunctions map[int]*anns.LSH         // LSH functions used to query tables
-	TablePIRParams     *sealpir.SerializedParams // SealPIR params for each hash table
+	TableNumBuckets    map[int]int                       // number of hash buckets in each table
+	TableHashFunctions map[int]*anns.LSH                 // LSH functions used to query tables (unless seeded)
+	TableHashParams    *anns.LSHParams                   // params (incl. seed) from which the LSH functions are derived
+	TableQuantizer     *anns.Quantizer                   // quantizer of the vectors in the table buckets
+	TablePIRParams     *sealpir.SerializedParams         // SealPIR params for each hash table
+	AdDirectory        *adstore.Directory                // location of each ad creative in the ad databases
+	AdPIRParams        map[int]*sealpir.SerializedParams // SealPIR params for each size class of the ad database
+	AdBids             map[int]float64                   // bid of each ad ID (for client-side auctions)
+	AdCampaigns        map[int]int                       // campaign of each ad ID
+	AdCaps             map[int]int                       // frequency cap of each ad ID (uncapped if missing)
+	CampaignCaps       map[int]int                       // frequency cap of each campaign (uncapped if missing)
 
 	StatsTotalTimeInMS int64
 }
 
 // TerminateSessionArgs used by client to kill the server (useful for experiments)
-type TerminateSessionArgs struct{}
+type TerminateSessionArgs struct {
+	ClientID uint64 // client whose PIR keys are dropped by the server
+}
 
 // TerminateSessionResponse  response to clients terminate session call
 type TerminateSessionResponse struct{}
@@ -84,4 +103,6 @@ type SessionParameters struct {
 	NumTables     int // number of hash tables
 	NumProbes     int // number of probes per hash table
 	NumTableDBs   int // number of databases representing hash tables to query
+
+	Metric anns.DistanceMetric // distance metric the hash tables are sensitive to
 }
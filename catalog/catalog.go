@@ -0,0 +1,237 @@
+package catalog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/sachaservan/vec"
+)
+
+// MaxAdID is the largest ad ID (IDs are stored in 4 bytes in the table buckets)
+const MaxAdID = math.MaxUint32
+
+// Campaign groups the ads of an advertiser that share a budget
+type Campaign struct {
+	ID         int     `json:"id"`
+	Advertiser string  `json:"advertiser"`
+	Budget     float64 `json:"budget"` // total amount the advertiser is willing to spend
+
+	// max number of impressions of the ads of the campaign per client (uncapped if 0)
+	FrequencyCap int `json:"frequency_cap,omitempty"`
+}
+
+// Ad is an ad with its creative, targeting vector, and bid
+type Ad struct {
+	ID           int       `json:"id"`
+	CampaignID   int       `json:"campaign_id"`
+	Bid          float64   `json:"bid"`    // max price per impression
+	Vector       []float64 `json:"vector"` // targeting vector
+	Creative     []byte    `json:"creative,omitempty"`
+	CreativeFile string    `json:"creative_file,omitempty"` // read into Creative (relative to the catalog)
+	FrequencyCap int       `json:"frequency_cap,omitempty"` // max number of impressions per client (uncapped if 0)
+}
+
+// Catalog is the set of ads (and their campaigns) served by the server
+type Catalog struct {
+	Campaigns []*Campaign `json:"campaigns"`
+	Ads       []*Ad       `json:"ads"`
+}
+
+// Load reads a JSON catalog from a file. Creative files
+// are resolved relative to the directory of the catalog.
+func Load(path string) (*Catalog, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Read(f, filepath.Dir(path))
+}
+
+// Read reads a JSON catalog from r and validates it.
+// Creative files are resolved relative to dir.
+func Read(r io.Reader, dir string) (*Catalog, error) {
+
+	c := &Catalog{}
+	if err := json.NewDecoder(r).Decode(c); err != nil {
+		return nil, err
+	}
+
+	for _, ad := range c.Ads {
+		if ad.CreativeFile == "" {
+			continue
+		}
+
+		if ad.Creative != nil {
+			return nil, fmt.Errorf("ad %v has both a creative and a creative file", ad.ID)
+		}
+
+		path := ad.CreativeFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+
+		creative, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		ad.Creative = creative
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Write writes the catalog to w as JSON (with the creatives inlined)
+func (c *Catalog) Write(w io.Writer) error {
+
+	inlined := &Catalog{Campaigns: c.Campaigns, Ads: make([]*Ad, len(c.Ads))}
+	for i, ad := range c.Ads {
+		copied := *ad
+		copied.CreativeFile = ""
+		inlined.Ads[i] = &copied
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", " ")
+	return enc.Encode(inlined)
+}
+
+// Validate checks that ad and campaign IDs are unique, that ad IDs are in [0, MaxAdID],
+// that every ad belongs to a campaign, that bids, budgets, and frequency caps are
+// non-negative, and that all targeting vectors have the same dimension
+func (c *Catalog) Validate() error {
+
+	if len(c.Ads) == 0 {
+		return errors.New("catalog has no ads")
+	}
+
+	campaigns := make(map[int]bool)
+	for _, campaign := range c.Campaigns {
+		if campaigns[campaign.ID] {
+			return fmt.Errorf("duplicate campaign ID %v", campaign.ID)
+		}
+
+		if campaign.Budget < 0 {
+			return fmt.Errorf("campaign %v has a negative budget", campaign.ID)
+		}
+
+		if campaign.FrequencyCap < 0 {
+			return fmt.Errorf("campaign %v has a negative frequency cap", campaign.ID)
+		}
+		campaigns[campaign.ID] = true
+	}
+
+	ads := make(map[int]bool)
+	for _, ad := range c.Ads {
+		if ad.ID < 0 {
+			return fmt.Errorf("ad %v has a negative ID", ad.ID)
+		}
+
+		if int64(ad.ID) > MaxAdID {
+			return fmt.Errorf("ad %v has an ID larger than %v", ad.ID, MaxAdID)
+		}
+
+		if ads[ad.ID] {
+			return fmt.Errorf("duplicate ad ID %v", ad.ID)
+		}
+
+		if !campaigns[ad.CampaignID] {
+			return fmt.Errorf("ad %v belongs to unknown campaign %v", ad.ID, ad.CampaignID)
+		}
+
+		if ad.Bid < 0 {
+			return fmt.Errorf("ad %v has a negative bid", ad.ID)
+		}
+
+		if ad.FrequencyCap < 0 {
+			return fmt.Errorf("ad %v has a negative frequency cap", ad.ID)
+		}
+
+		if len(ad.Vector) == 0 || len(ad.Vector) != len(c.Ads[0].Vector) {
+			return fmt.Errorf("ad %v has a targeting vector of the wrong dimension", ad.ID)
+		}
+		ads[ad.ID] = true
+	}
+
+	return nil
+}
+
+// NumFeatures returns the dimension of the targeting vectors
+func (c *Catalog) NumFeatures() int {
+	if len(c.Ads) == 0 {
+		return 0
+	}
+	return len(c.Ads[0].Vector)
+}
+
+// Ad returns the ad with the given ID (nil if there is none)
+func (c *Catalog) Ad(id int) *Ad {
+	for _, ad := range c.Ads {
+		if ad.ID == id {
+			return ad
+		}
+	}
+	return nil
+}
+
+// Campaign returns the campaign with the given ID (nil if there is none)
+func (c *Catalog) Campaign(id int) *Campaign {
+	for _, campaign := range c.Campaigns {
+		if campaign.ID == id {
+			return campaign
+		}
+	}
+	return nil
+}
+
+// IDs returns the ID of each ad (in catalog order)
+func (c *Catalog) IDs() []int {
+	ids := make([]int, len(c.Ads))
+	for i, ad := range c.Ads {
+		ids[i] = ad.ID
+	}
+	return ids
+}
+
+// Vectors returns the targeting vector of each ad (in catalog order)
+func (c *Catalog) Vectors() []*vec.Vec {
+	vectors := make([]*vec.Vec, len(c.Ads))
+	for i, ad := range c.Ads {
+		coords := make([]float64, len(ad.Vector))
+		copy(coords, ad.Vector)
+		vectors[i] = vec.NewVec(coords)
+	}
+	return vectors
+}
+
+// Bids returns the bid of each ad (in catalog order)
+func (c *Catalog) Bids() []float64 {
+	bids := make([]float64, len(c.Ads))
+	for i, ad := range c.Ads {
+		bids[i] = ad.Bid
+	}
+	return bids
+}
+
+// Creatives returns the creative of each ad ID (ads without a creative are omitted)
+func (c *Catalog) Creatives() map[int][]byte {
+	creatives := make(map[int][]byte)
+	for _, ad := range c.Ads {
+		if ad.Creative != nil {
+			creatives[ad.ID] = ad.Creative
+		}
+	}
+	return creatives
+}
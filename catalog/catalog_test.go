@@ -0,0 +1,120 @@
+package catalog
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testCatalog = `{
+ "campaigns": [
+  {"id": 1, "advertiser": "shoes", "budget": 100, "frequency_cap": 5},
+  {"id": 2, "advertiser": "books", "budget": 50}
+ ],
+ "ads": [
+  {"id": 7, "campaign_id": 1, "bid": 0.5, "vector": [1, 2, 3], "creative": "aGVsbG8="},
+  {"id": 3, "campaign_id": 2, "bid": 1.5, "vector": [4, 5, 6], "creative_file": "banner.html"},
+  {"id": 9, "campaign_id": 2, "bid": 0.1, "vector": [7, 8, 9], "frequency_cap": 2}
+ ]
+}`
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	banner := []byte("<div>banner</div>")
+	if err := ioutil.WriteFile(filepath.Join(dir, "banner.html"), banner, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "catalog.json")
+	if err := ioutil.WriteFile(path, []byte(testCatalog), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.Ads) != 3 || len(c.Campaigns) != 2 || c.NumFeatures() != 3 {
+		t.Fatalf("catalog was not loaded correctly")
+	}
+
+	ids := c.IDs()
+	bids := c.Bids()
+	vectors := c.Vectors()
+	for i, ad := range c.Ads {
+		if ids[i] != ad.ID || bids[i] != ad.Bid || vectors[i].Coords[0] != ad.Vector[0] {
+			t.Fatalf("ad %v does not match the catalog order", ad.ID)
+		}
+	}
+
+	creatives := c.Creatives()
+	if len(creatives) != 2 {
+		t.Fatalf("expected 2 creatives, got %v", len(creatives))
+	}
+
+	if string(creatives[7]) != "hello" || !bytes.Equal(creatives[3], banner) {
+		t.Fatalf("creatives were not loaded correctly")
+	}
+
+	if c.Ad(9).FrequencyCap != 2 || c.Campaign(1).FrequencyCap != 5 {
+		t.Fatalf("frequency caps were not loaded correctly")
+	}
+
+	if c.Ad(9).CampaignID != 2 || c.Campaign(c.Ad(9).CampaignID).Advertiser != "books" {
+		t.Fatalf("ad 9 does not belong to the right campaign")
+	}
+
+	if c.Ad(4) != nil || c.Campaign(3) != nil {
+		t.Fatalf("found an ad or campaign that is not in the catalog")
+	}
+
+	// round trip with the creatives inlined
+	var buf bytes.Buffer
+	if err := c.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := Read(&buf, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(res.Ad(3).Creative, banner) {
+		t.Fatalf("creative was not written correctly")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	invalid := []string{
+		`{"campaigns": [{"id": 1}], "ads": []}`,
+		`{"campaigns": [{"id": 1}], "ads": [{"id": 1, "campaign_id": 2, "vector": [1]}]}`,
+		`{"campaigns": [{"id": 1}], "ads": [{"id": 1, "campaign_id": 1, "vector": [1]}, {"id": 1, "campaign_id": 1, "vector": [1]}]}`,
+		`{"campaigns": [{"id": 1}], "ads": [{"id": 1, "campaign_id": 1, "vector": [1]}, {"id": 2, "campaign_id": 1, "vector": [1, 2]}]}`,
+		`{"campaigns": [{"id": 1}], "ads": [{"id": 1, "campaign_id": 1, "bid": -1, "vector": [1]}]}`,
+		`{"campaigns": [{"id": 1, "budget": -1}], "ads": [{"id": 1, "campaign_id": 1, "vector": [1]}]}`,
+		`{"campaigns": [{"id": 1}, {"id": 1}], "ads": [{"id": 1, "campaign_id": 1, "vector": [1]}]}`,
+		`{"campaigns": [{"id": 1}], "ads": [{"id": 1, "campaign_id": 1, "frequency_cap": -1, "vector": [1]}]}`,
+		`{"campaigns": [{"id": 1, "frequency_cap": -1}], "ads": [{"id": 1, "campaign_id": 1, "vector": [1]}]}`,
+		`{"campaigns": [{"id": 1}], "ads": [{"id": 4294967296, "campaign_id": 1, "vector": [1]}]}`,
+	}
+
+	for i, s := range invalid {
+		if _, err := Read(strings.NewReader(s), ""); err == nil {
+			t.Fatalf("expected an error for invalid catalog %v", i)
+		}
+	}
+
+	largest := `{"campaigns": [{"id": 1}], "ads": [{"id": 4294967295, "campaign_id": 1, "vector": [1]}]}`
+	if _, err := Read(strings.NewReader(largest), ""); err != nil {
+		t.Fatalf("failed to read a catalog with the largest ad ID: %v", err)
+	}
+}
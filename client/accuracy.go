@@ -0,0 +1,92 @@
+package client
+
+import (
+	"github.com/sachaservan/adveil/anns"
+
+	"github.com/sachaservan/vec"
+)
+
+// SimulateBucketQuery retrieves the same buckets from the tables of knn
+// as QueryBuckets does privately (tables must be built with NumBuckets set).
+// Returns the (deduplicated) candidate indices along with the number of
+// retrieved buckets and the number of those that were empty.
+func SimulateBucketQuery(knn *anns.LSHBasedKNN, profile *vec.Vec) ([]int, int, int) {
+	return knn.RetrieveBuckets(profile)
+}
+
+// EvaluateAccuracy runs each query through the same bucket retrieval path
+// as the private client and compares the top-k results to the exact
+// k nearest neighbors in the data of knn. Candidates are ranked on their
+// quantized vectors since those are what the client decodes from the buckets.
+// The exact neighbors (indices into the data) of each query are computed
+// by brute force if groundTruth is nil.
+func EvaluateAccuracy(knn *anns.LSHBasedKNN, queries []*vec.Vec, k int, groundTruth [][]int) (*AccuracyExperiment, error) {
+
+	// same quantizer as the server (see server.BuildKNNDataStructure)
+	quantizer, err := anns.NewQuantizer(knn.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	// vectors as decoded by the client (see anns.DecodeQuantizedBucket)
+	decoded := make([]*vec.Vec, len(knn.Data))
+	for i, v := range knn.Data {
+		if v == nil {
+			continue
+		}
+
+		levels, err := quantizer.Quantize(v)
+		if err != nil {
+			return nil, err
+		}
+
+		decoded[i], err = quantizer.Dequantize(levels)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	experiment := &AccuracyExperiment{
+		NumCategories:    len(knn.Data),
+		NumFeatures:      knn.Params.NumFeatures,
+		NumTables:        knn.Params.NumTables,
+		NumProbes:        knn.Params.NumProbes,
+		NumBuckets:       knn.Params.NumBuckets,
+		BucketSize:       knn.Params.BucketSize,
+		K:                k,
+		RecallAtK:        make([]float64, 0),
+		CandidateSetSize: make([]int, 0),
+		EmptyBucketRate:  make([]float64, 0),
+	}
+
+	stats := knn.OverflowStats()
+	experiment.NumDisplaced = stats.NumDisplaced
+	experiment.NumMissing = stats.NumMissing
+
+	dist := knn.DistanceFunction()
+	for i, q := range queries {
+		candidates, numRetrieved, numEmpty := SimulateBucketQuery(knn, q)
+
+		vectors := make([]*vec.Vec, len(candidates))
+		for j, index := range candidates {
+			vectors[j] = decoded[index]
+		}
+		approx := RankCandidates(q, candidates, vectors, knn.Params.Metric, k)
+
+		var exact []int
+		if groundTruth != nil {
+			exact = groundTruth[i]
+			if k < len(exact) {
+				exact = exact[:k]
+			}
+		} else {
+			exact = anns.BruteForceKNN(knn.Data, q, k, dist)
+		}
+
+		experiment.RecallAtK = append(experiment.RecallAtK, anns.Recall(approx, exact))
+		experiment.CandidateSetSize = append(experiment.CandidateSetSize, len(candidates))
+		experiment.EmptyBucketRate = append(experiment.EmptyBucketRate, float64(numEmpty)/float64(numRetrieved))
+	}
+
+	return experiment, nil
+}
@@ -0,0 +1,188 @@
+package client
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/sachaservan/adveil/anns"
+
+	"github.com/sachaservan/vec"
+)
+
+func getTestKNN(t *testing.T, numProbes int) *anns.LSHBasedKNN {
+
+	params := &anns.LSHParams{
+		NumFeatures:     10,
+		NumTables:       5,
+		NumProbes:       numProbes,
+		NumProjections:  2,
+		ProjectionWidth: 20,
+		Metric:          anns.EuclideanDistance,
+		NumBuckets:      anns.PartitionedNumBuckets(100, numProbes, 1),
+		Seed:            1,
+	}
+
+	knn, err := anns.NewLSHBased(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := make([]*vec.Vec, 200)
+	for i := range data {
+		data[i] = vec.NewRandomVec(params.NumFeatures, -50, 50)
+	}
+
+	if _, err := knn.BuildWithData(data, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	return knn
+}
+
+func TestSimulateBucketQuery(t *testing.T) {
+
+	for _, numProbes := range []int{1, 2, 4} {
+		knn := getTestKNN(t, numProbes)
+
+		for i, q := range knn.Data {
+			candidates, numRetrieved, numEmpty := SimulateBucketQuery(knn, q)
+
+			// the bucket of the query is the first probe in every table
+			if numRetrieved < knn.Params.NumTables || numRetrieved > knn.Params.NumTables*numProbes {
+				t.Fatalf("retrieved %v buckets with %v probes", numRetrieved, numProbes)
+			}
+
+			if numEmpty > numRetrieved-knn.Params.NumTables {
+				t.Fatalf("%v of %v retrieved buckets are empty", numEmpty, numRetrieved)
+			}
+
+			seen := make(map[int]bool)
+			for _, index := range candidates {
+				if seen[index] {
+					t.Fatalf("candidate %v is returned twice", index)
+				}
+				seen[index] = true
+			}
+
+			if !seen[i] {
+				t.Fatalf("point %v is not a candidate of its own query", i)
+			}
+
+			if numProbes == 1 {
+				// a single probe retrieves the bucket of the query in each table
+				expected := knn.Candidates(q)
+				sort.Ints(candidates)
+				if len(candidates) != len(expected) {
+					t.Fatalf("expected %v candidates, got %v", len(expected), len(candidates))
+				}
+
+				for j := range expected {
+					if candidates[j] != expected[j] {
+						t.Fatalf("expected candidates %v, got %v", expected, candidates)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestEvaluateAccuracy(t *testing.T) {
+
+	knn := getTestKNN(t, 2)
+
+	queries := knn.Data[:20]
+
+	// every point is its own nearest neighbor
+	groundTruth := make([][]int, len(queries))
+	for i := range groundTruth {
+		groundTruth[i] = []int{i, -1, -1}
+	}
+
+	for _, gt := range [][][]int{nil, groundTruth} {
+		experiment, err := EvaluateAccuracy(knn, queries, 1, gt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if experiment.NumCategories != len(knn.Data) || experiment.K != 1 || experiment.NumBuckets != knn.Params.NumBuckets {
+			t.Fatalf("experiment does not describe the data structure")
+		}
+
+		if len(experiment.RecallAtK) != len(queries) ||
+			len(experiment.CandidateSetSize) != len(queries) ||
+			len(experiment.EmptyBucketRate) != len(queries) {
+			t.Fatalf("expected one result per query")
+		}
+
+		for i := range queries {
+			if experiment.RecallAtK[i] != 1 {
+				t.Fatalf("query %v has recall %v, expected 1", i, experiment.RecallAtK[i])
+			}
+
+			if experiment.CandidateSetSize[i] < 1 {
+				t.Fatalf("query %v has no candidates", i)
+			}
+
+			if experiment.EmptyBucketRate[i] < 0 || experiment.EmptyBucketRate[i] > 1 {
+				t.Fatalf("query %v has empty bucket rate %v", i, experiment.EmptyBucketRate[i])
+			}
+		}
+	}
+
+	// points that are not retrieved lower the recall
+	for i := range groundTruth {
+		groundTruth[i] = []int{len(knn.Data)}
+	}
+
+	experiment, err := EvaluateAccuracy(knn, queries, 1, groundTruth)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range queries {
+		if experiment.RecallAtK[i] != 0 {
+			t.Fatalf("query %v has recall %v, expected 0", i, experiment.RecallAtK[i])
+		}
+	}
+}
+
+func TestEvaluateAccuracyQuantized(t *testing.T) {
+
+	params := &anns.LSHParams{
+		NumFeatures:     1,
+		NumTables:       1,
+		NumProbes:       1,
+		NumProjections:  1,
+		ProjectionWidth: 1e6,
+		Metric:          anns.EuclideanDistance,
+		NumBuckets:      anns.PartitionedNumBuckets(10, 1, 1),
+		Seed:            1,
+	}
+
+	knn, err := anns.NewLSHBased(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first two points have the same quantized value
+	data := []*vec.Vec{vec.NewVec([]float64{0}), vec.NewVec([]float64{0.3}), vec.NewVec([]float64{255})}
+	if _, err := knn.BuildWithData(data, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	query := vec.NewVec([]float64{0.3})
+	candidates, _, _ := SimulateBucketQuery(knn, query)
+	if len(candidates) != len(data) {
+		t.Fatalf("expected all points in the same bucket, got %v", candidates)
+	}
+
+	// the client cannot tell the first two points apart
+	experiment, err := EvaluateAccuracy(knn, []*vec.Vec{query}, 1, [][]int{{1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if experiment.RecallAtK[0] != 0 {
+		t.Fatalf("expected the quantized ranking to miss the exact neighbor")
+	}
+}
@@ -0,0 +1,137 @@
+package client
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/sachaservan/adveil/anns"
+	"github.com/sachaservan/adveil/api"
+
+	"github.com/sachaservan/vec"
+)
+
+// AuctionType determines how candidate ads are ranked and priced
+type AuctionType int
+
+const (
+	// SecondPrice ranks ads by bid; the winner pays the second highest bid
+	SecondPrice AuctionType = iota
+	// QualityWeighted ranks ads by bid times the similarity of the ad to the
+	// profile; the winner pays the lowest bid with which it would still win
+	QualityWeighted
+)
+
+// ErrNoWinner is returned by an auction in which no candidate meets the reserve price
+var ErrNoWinner = errors.New("no candidate ad meets the reserve price")
+
+// Auction is run by the client over the candidate ads recovered from the tables
+type Auction struct {
+	Type    AuctionType
+	Reserve float64             // min clearing price (ads bidding less are not considered)
+	Metric  anns.DistanceMetric // distance used to compute the quality of an ad
+}
+
+// AuctionResult is the outcome of an auction. Only the winning ad and the
+// clearing price are kept so that the result can be reported without
+// revealing the losing candidates (see Report).
+type AuctionResult struct {
+	AdID  int
+	Price float64
+}
+
+// ParseAuctionType returns the auction type with the given name
+// (one of "second-price" or "quality-weighted")
+func ParseAuctionType(name string) (AuctionType, error) {
+	switch name {
+	case "second-price":
+		return SecondPrice, nil
+	case "quality-weighted":
+		return QualityWeighted, nil
+	default:
+		return 0, errors.New("unknown auction type " + name)
+	}
+}
+
+// Run selects the winning ad among the candidates (with the given targeting
+// vectors) and its clearing price. Candidates without a bid are assigned a bid of 0.
+// The price is at least the reserve and at most the bid of the winner.
+// Ties are broken in favor of the smallest ad ID.
+func (auction *Auction) Run(profile *vec.Vec, ids []int, vectors []*vec.Vec, bids map[int]float64) (*AuctionResult, error) {
+
+	dist := anns.MetricDistance(auction.Metric)
+
+	type candidate struct {
+		id      int
+		bid     float64
+		quality float64
+		score   float64
+	}
+
+	seen := make(map[int]bool)
+	candidates := make([]*candidate, 0, len(ids))
+	for i, id := range ids {
+		if seen[id] || bids[id] < auction.Reserve {
+			continue
+		}
+		seen[id] = true
+
+		c := &candidate{id: id, bid: bids[id], quality: 1}
+		if auction.Type == QualityWeighted {
+			// similarity in (0, 1] that decreases with the distance
+			c.quality = 1 / (1 + dist(profile, vectors[i]))
+		}
+		c.score = c.bid * c.quality
+
+		candidates = append(candidates, c)
+	}
+
+	if len(candidates) == 0 {
+		return nil, ErrNoWinner
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		return candidates[i].id < candidates[j].id
+	})
+
+	winner := candidates[0]
+	price := auction.Reserve
+	if len(candidates) > 1 {
+		// lowest bid with which the winner still outscores the runner-up
+		if p := candidates[1].score / winner.quality; p > price {
+			price = p
+		}
+	}
+
+	if price > winner.bid {
+		price = winner.bid
+	}
+
+	return &AuctionResult{AdID: winner.id, Price: price}, nil
+}
+
+// Report returns the report of the auction outcome sent to the broker
+// (the winning ad and the clearing price)
+func (res *AuctionResult) Report() *api.AuctionReport {
+	return &api.AuctionReport{
+		AdID:  res.AdID,
+		Price: res.Price,
+	}
+}
+
+// RunAuction runs the auction over the ads returned by the last call to QueryBuckets
+// using the bids provided by the server
+func (client *Client) RunAuction(auction *Auction, ads []int) (*AuctionResult, error) {
+
+	vectors := make([]*vec.Vec, len(ads))
+	for i, id := range ads {
+		vectors[i] = client.CandidateVectors[id]
+		if vectors[i] == nil {
+			return nil, errors.New("ad was not returned by QueryBuckets")
+		}
+	}
+
+	return auction.Run(client.Profile, ads, vectors, client.AdBids)
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"math"
+	"testing"
+
+	"github.com/sachaservan/adveil/anns"
+
+	"github.com/sachaservan/vec"
+)
+
+func TestAuction(t *testing.T) {
+
+	profile := vec.NewVec([]float64{0, 0})
+
+	// quality of ad 1 is 1/6 and quality of ad 2 is 1/2 (euclidean distance)
+	vectors := map[int]*vec.Vec{
+		1: vec.NewVec([]float64{3, 4}),
+		2: vec.NewVec([]float64{0, 1}),
+		3: vec.NewVec([]float64{0, 0}),
+		4: vec.NewVec([]float64{0, 0}),
+	}
+
+	tests := []struct {
+		name    string
+		typ     AuctionType
+		reserve float64
+		ids     []int
+		bids    map[int]float64
+		winner  int
+		price   float64
+		err     error
+	}{
+		{"second price", SecondPrice, 0, []int{1, 2, 3}, map[int]float64{1: 10, 2: 5, 3: 1}, 1, 5, nil},
+		{"order of candidates", SecondPrice, 0, []int{3, 2, 1}, map[int]float64{1: 10, 2: 5, 3: 1}, 1, 5, nil},
+		{"reserve below runner-up", SecondPrice, 2, []int{1, 2, 3}, map[int]float64{1: 10, 2: 5, 3: 1}, 1, 5, nil},
+		{"reserve above runner-up", SecondPrice, 7, []int{1, 2, 3}, map[int]float64{1: 10, 2: 5, 3: 1}, 1, 7, nil},
+		{"reserve equal to bid", SecondPrice, 10, []int{1, 2}, map[int]float64{1: 10, 2: 5}, 1, 10, nil},
+		{"reserve above all bids", SecondPrice, 20, []int{1, 2}, map[int]float64{1: 10, 2: 5}, 0, 0, ErrNoWinner},
+		{"zero bids", SecondPrice, 0, []int{2, 1}, map[int]float64{1: 0, 2: 0}, 1, 0, nil},
+		{"missing bid", SecondPrice, 0, []int{4, 2}, map[int]float64{2: 3}, 2, 0, nil},
+		{"negative bid", SecondPrice, 0, []int{1, 2}, map[int]float64{1: -1, 2: 3}, 2, 0, nil},
+		{"only negative bids", SecondPrice, 0, []int{1, 2}, map[int]float64{1: -1, 2: -3}, 0, 0, ErrNoWinner},
+		{"duplicate ids", SecondPrice, 0, []int{1, 1, 2}, map[int]float64{1: 10, 2: 5}, 1, 5, nil},
+		{"duplicate winner only", SecondPrice, 1, []int{1, 1}, map[int]float64{1: 10}, 1, 1, nil},
+		{"single candidate", SecondPrice, 0, []int{2}, map[int]float64{2: 5}, 2, 0, nil},
+		{"single candidate with reserve", SecondPrice, 2, []int{2}, map[int]float64{2: 5}, 2, 2, nil},
+		{"tie", SecondPrice, 0, []int{2, 1}, map[int]float64{1: 5, 2: 5}, 1, 5, nil},
+		{"no candidates", SecondPrice, 0, []int{}, map[int]float64{}, 0, 0, ErrNoWinner},
+		{"quality weighted", QualityWeighted, 0, []int{1, 2}, map[int]float64{1: 12, 2: 2}, 1, 6, nil},
+		{"quality weighted closer ad", QualityWeighted, 0, []int{1, 2}, map[int]float64{1: 6, 2: 4}, 2, 2, nil},
+		{"quality weighted reserve", QualityWeighted, 3, []int{1, 2}, map[int]float64{1: 6, 2: 4}, 2, 3, nil},
+		{"quality weighted single candidate", QualityWeighted, 1, []int{1}, map[int]float64{1: 6}, 1, 1, nil},
+	}
+
+	for _, test := range tests {
+		candidateVectors := make([]*vec.Vec, len(test.ids))
+		for i, id := range test.ids {
+			candidateVectors[i] = vectors[id]
+		}
+
+		auction := &Auction{Type: test.typ, Reserve: test.reserve, Metric: anns.EuclideanDistance}
+		res, err := auction.Run(profile, test.ids, candidateVectors, test.bids)
+		if err != test.err {
+			t.Fatalf("%v: expected error %v, got %v", test.name, test.err, err)
+		}
+
+		if err != nil {
+			continue
+		}
+
+		if res.AdID != test.winner {
+			t.Fatalf("%v: expected ad %v to win, got %v", test.name, test.winner, res.AdID)
+		}
+
+		if math.Abs(res.Price-test.price) > 1e-9 {
+			t.Fatalf("%v: expected price %v, got %v", test.name, test.price, res.Price)
+		}
+	}
+}
+
+func TestParseAuctionType(t *testing.T) {
+
+	for name, expected := range map[string]AuctionType{"second-price": SecondPrice, "quality-weighted": QualityWeighted} {
+		typ, err := ParseAuctionType(name)
+		if err != nil || typ != expected {
+			t.Fatalf("failed to parse auction type %v", name)
+		}
+	}
+
+	if _, err := ParseAuctionType("first-price"); err == nil {
+		t.Fatalf("expected an error for an unknown auction type")
+	}
+}
@@ -5,8 +5,11 @@ import (
 	"encoding/gob"
 	"fmt"
 	"log"
+	"math/rand"
 	"net/rpc"
+	"sort"
 
+	"github.com/sachaservan/adveil/adstore"
 	"github.com/sachaservan/adveil/anns"
 	"github.com/sachaservan/adveil/api"
 	"github.com/sachaservan/adveil/sealpir"
@@ -17,14 +20,37 @@ import (
 // RuntimeExperiment captures all the information needed to
 // evaluate a live deployment
 type RuntimeExperiment struct {
-	NumCategories            int     `json:"num_categories"`
-	NumFeatures              int     `json:"num_features"`
-	NumTables                int     `json:"num_tables"`
-	GetBucketServerMS        []int64 `json:"get_bucket_server_ms"`
-	GetBucketClientMS        []int64 `json:"get_bucket_client_ms"`
-	GetBucketBandwidthDownB  []int64 `json:"get_bucket_bandwidth_down_bytes"`
-	GetBucketBandwidthUpB    []int64 `json:"get_bucket_bandwidth_up_bytes"`
-	GetBucketBandwidthNaiveB []int64 `json:"get_bucket_bandwidth_naive_bytes"`
+	NumCategories             int     `json:"num_categories"`
+	NumFeatures               int     `json:"num_features"`
+	NumTables                 int     `json:"num_tables"`
+	GetBucketServerMS         []int64 `json:"get_bucket_server_ms"`
+	GetBucketClientMS         []int64 `json:"get_bucket_client_ms"`
+	GetBucketBandwidthDownB   []int64 `json:"get_bucket_bandwidth_down_bytes"`
+	GetBucketBandwidthUpB     []int64 `json:"get_bucket_bandwidth_up_bytes"`
+	GetBucketBandwidthNaiveB  []int64 `json:"get_bucket_bandwidth_naive_bytes"`
+	GetAdServerMS             []int64 `json:"get_ad_server_ms"`
+	GetAdClientMS             []int64 `json:"get_ad_client_ms"`
+	GetAdBandwidthDownB       []int64 `json:"get_ad_bandwidth_down_bytes"`
+	GetAdBandwidthUpB         []int64 `json:"get_ad_bandwidth_up_bytes"`
+	GetAdNonPrivateClientMS   []int64 `json:"get_ad_non_private_client_ms"`
+	GetAdNonPrivateBandwidthB []int64 `json:"get_ad_non_private_bandwidth_bytes"`
+}
+
+// AccuracyExperiment captures the quality of the targeting
+// data structure as seen by a (simulated) private client
+type AccuracyExperiment struct {
+	NumCategories    int       `json:"num_categories"`
+	NumFeatures      int       `json:"num_features"`
+	NumTables        int       `json:"num_tables"`
+	NumProbes        int       `json:"num_probes"`
+	NumBuckets       int       `json:"num_buckets"`
+	BucketSize       int       `json:"bucket_size"`
+	K                int       `json:"k"`
+	RecallAtK        []float64 `json:"recall_at_k"`
+	CandidateSetSize []int     `json:"candidate_set_size"`
+	EmptyBucketRate  []float64 `json:"empty_bucket_rate"`
+	NumDisplaced     int       `json:"num_displaced"` // times a value was left out of a table due to a full bucket
+	NumMissing       int       `json:"num_missing"`   // values that are not stored in any table
 }
 
 const BrokerServerID int = 0
@@ -38,10 +64,22 @@ type Client struct {
 	// SealPIR related
 	// NOTE: "client" here refers to the PIR client in SealPIR
 	// and is a bridge between Go and C++ code
-	TablePIRClient     *sealpir.Client     // clients used to query each tables
-	TablePIRKeys       *sealpir.GaloisKeys // keys used to query each hash table
-	TableNumBuckets    map[int]int         // number of hash buckets in each table
-	TableHashFunctions map[int]*anns.LSH   // LSH functions used to query tables
+	TablePIRClient     *sealpir.Client             // clients used to query each tables
+	TablePIRKeys       *sealpir.GaloisKeys         // keys used to query each hash table
+	TableNumBuckets    map[int]int                 // number of hash buckets in each table
+	TableHashFunctions map[int]*anns.LSH           // LSH functions used to query tables
+	TableQuantizer     *anns.Quantizer             // quantizer of the vectors in the table buckets
+	AdDirectory        *adstore.Directory          // location of each ad creative in the ad databases
+	AdPIRClients       map[int]*sealpir.Client     // clients used to query each size class of the ad database
+	AdPIRKeys          map[int]*sealpir.GaloisKeys // keys used to query each size class of the ad database
+	AdBids             map[int]float64             // bid of each ad ID (used in auctions)
+	AdCampaigns        map[int]int                 // campaign of each ad ID
+	AdCaps             map[int]int                 // frequency cap of each ad ID (uncapped if missing)
+	CampaignCaps       map[int]int                 // frequency cap of each campaign (uncapped if missing)
+	CandidateVectors   map[int]*vec.Vec            // targeting vector of each ad returned by QueryBuckets
+
+	// impressions of the ads shown to the client (kept locally)
+	Impressions *ImpressionStore
 
 	// client's profile feature vector
 	Profile    *vec.Vec
@@ -80,10 +118,44 @@ func (client *Client) InitSession() {
 
 		client.TableNumBuckets = res.TableNumBuckets
 		client.TableHashFunctions = res.TableHashFunctions
+		client.TableQuantizer = res.TableQuantizer
+
+		if res.TableHashParams != nil {
+			// regenerate the hash functions locally from the seed
+			knn, err := anns.NewLSHBased(res.TableHashParams)
+			if err != nil {
+				panic(err)
+			}
+			client.TableHashFunctions = knn.Hashes
+		}
+
+		// the hash functions must map the profile to a valid bucket index
+		for tableIndex, h := range client.TableHashFunctions {
+			if h.UHash == nil || h.NumBuckets != client.TableNumBuckets[tableIndex] {
+				panic("hash functions do not match the number of buckets in the tables")
+			}
+		}
 	} else {
 		panic("no table PIR params provided")
 	}
 
+	client.AdBids = res.AdBids
+	client.AdCampaigns = res.AdCampaigns
+	client.AdCaps = res.AdCaps
+	client.CampaignCaps = res.CampaignCaps
+
+	if res.AdDirectory != nil {
+		// initialize the SealPIR clients used to query each size class of the ad database
+		client.AdDirectory = res.AdDirectory
+		client.AdPIRClients = make(map[int]*sealpir.Client)
+		client.AdPIRKeys = make(map[int]*sealpir.GaloisKeys)
+		for class, params := range sealpir.DeserializeParamsMap(res.AdPIRParams) {
+			c := sealpir.InitClient(params, 0)
+			client.AdPIRClients[class] = c
+			client.AdPIRKeys[class] = c.GenGaloisKeys()
+		}
+	}
+
 	client.SessionParams = &api.SessionParameters{
 		SessionID:     res.SessionID,
 		NumFeatures:   res.NumFeatures,
@@ -91,11 +163,17 @@ func (client *Client) InitSession() {
 		NumCategories: res.NumCategories,
 		NumProbes:     res.NumProbes,
 		NumTableDBs:   res.NumTableDBs,
+		Metric:        res.Metric,
 	}
 
 	// TODO: this is kind of a hack that is only ok for experiments
 	// gen profile here once the client knows how many features the server is running
-	client.Profile = vec.NewRandomVec(res.NumFeatures, -50, 50)
+	switch res.Metric {
+	case anns.HammingDistance, anns.JaccardDistance:
+		client.Profile = vec.NewRandomVec(res.NumFeatures, 0, 1)
+	default:
+		client.Profile = vec.NewRandomVec(res.NumFeatures, -50, 50)
+	}
 
 	// init the experiment
 	client.Experiment.NumCategories = res.NumCategories
@@ -103,12 +181,28 @@ func (client *Client) InitSession() {
 	client.Experiment.NumTables = res.NumTables
 }
 
+// SetProfileFromSet sets the client's profile to the set of
+// elements (e.g., keywords or site categories) for use with
+// tables built using the Jaccard distance metric
+func (client *Client) SetProfileFromSet(set []int) error {
+
+	profile, err := anns.SetToVec(set, client.SessionParams.NumFeatures)
+	if err != nil {
+		return err
+	}
+
+	client.Profile = profile
+
+	return nil
+}
+
 func (client *Client) SendPIRKeys() {
 
 	args := &api.SetKeysArgs{}
 	res := &api.SetKeysResponse{}
 
 	args.TableDBGaloisKeys = client.TablePIRKeys
+	args.AdDBGaloisKeys = client.AdPIRKeys
 
 	if !client.call("Server.SetPIRKeys", &args, &res) {
 		panic("failed to make RPC call")
@@ -121,23 +215,42 @@ func (client *Client) TerminateSessions() {
 	args := api.TerminateSessionArgs{}
 	res := api.TerminateSessionResponse{}
 
+	if client.TablePIRKeys != nil {
+		args.ClientID = client.TablePIRKeys.ClientID
+	}
+
 	if !client.call("Server.TerminateSession", &args, &res) {
 		panic("failed to make RPC call")
 	}
 
+	// each SealPIR client owns the params deserialized in InitSession
 	client.TablePIRClient.Free()
+	client.TablePIRClient.Params.Free()
 
+	for _, c := range client.AdPIRClients {
+		c.Free()
+		c.Params.Free()
+	}
+	client.AdPIRClients = nil
 }
 
 // QueryBuckets privately queries LSH tables held by the server
 // by first hashing the client's profile vector and then retrieving the corresponding
-// hash from the hash table
-func (client *Client) QueryBuckets() ([][]int, int64, int64, int64, int64) {
+// hash from the hash table. Returns the IDs of (at most) the k ads closest to
+// the profile among all ads in the retrieved buckets, closest first.
+func (client *Client) QueryBuckets(k int) ([]int, int64, int64, int64, int64) {
 
 	qargs := &api.BucketQueryArgs{}
 	qres := &api.BucketQueryResponse{}
 
-	allIndices := make([]int64, 0)
+	c := client.TablePIRClient
+	numProbes := client.SessionParams.NumProbes
+
+	// index of the item retrieved from each database
+	dbItems := make(map[int]int64)
+
+	// databases queried for a probed bucket (rather than an arbitrary one)
+	probed := make(map[int]bool)
 
 	// query each hash table for the bucket that collides with the
 	// client's profile feature vector under the server-provided LSH function
@@ -145,22 +258,25 @@ func (client *Client) QueryBuckets() ([][]int, int64, int64, int64, int64) {
 	for tableIndex := 0; tableIndex < client.SessionParams.NumTables; tableIndex++ {
 
 		h := client.TableHashFunctions[tableIndex]
-
-		numProbes := client.SessionParams.NumProbes
-		for probeIndex := 0; probeIndex < numProbes; probeIndex++ {
-
-			// simulate LSH-multiprobing perturbation
-			q := client.Profile.Copy()
-			noise := vec.NewRandomVec(client.Profile.Size(), 0, 255)
-			q.Add(noise)
-
-			elemIndex := h.Digest(q).Int64()
-			allIndices = append(allIndices, elemIndex)
-
-			c := client.TablePIRClient
+		numBuckets := client.TableNumBuckets[tableIndex]
+		partitionSize := numBuckets / numProbes
+
+		// the table is partitioned into numProbes databases;
+		// retrieve (at most) one probed bucket from each partition
+		// in order of the query-directed probing sequence
+		items := h.PartitionProbes(client.Profile, numProbes, partitionSize)
+
+		// partitions that no probe falls into are still queried
+		// (for an arbitrary bucket) so as to not reveal anything to the server
+		for partition := 0; partition < numProbes; partition++ {
+			dbIndex := tableIndex*numProbes + partition
+			dbItems[dbIndex] = items[partition]
+			_, probed[dbIndex] = items[partition]
+
+			_, elemIndex := c.Params.ParallelIndex(items[partition])
 			index := c.GetFVIndex(elemIndex)
 			query := c.GenQuery(index)
-			qargs.Queries[tableIndex*numProbes+probeIndex] = query
+			qargs.Queries[dbIndex] = query
 		}
 	}
 
@@ -169,16 +285,12 @@ func (client *Client) QueryBuckets() ([][]int, int64, int64, int64, int64) {
 	diff := client.SessionParams.NumTableDBs - numQueries
 	for extra := 0; extra < diff; extra++ {
 
-		// simulate LSH-multiprobing perturbation
-		q := client.Profile.Copy()
-		noise := vec.NewRandomVec(client.Profile.Size(), 0, 255)
-		q.Add(noise)
-
-		h := client.TableHashFunctions[0]
-		elemIndex := h.Digest(q).Int64()
-		allIndices = append(allIndices, elemIndex)
+		// arbitrary item in the partition
+		partitionSize := client.TableNumBuckets[0] / numProbes
+		item := rand.Int63n(int64(partitionSize))
+		dbItems[numQueries+extra] = item
 
-		c := client.TablePIRClient
+		_, elemIndex := c.Params.ParallelIndex(item)
 		index := c.GetFVIndex(elemIndex)
 		query := c.GenQuery(index)
 		qargs.Queries[numQueries+extra] = query
@@ -188,13 +300,45 @@ func (client *Client) QueryBuckets() ([][]int, int64, int64, int64, int64) {
 		panic("failed to make RPC call")
 	}
 
-	// recover the result
-	// TODO: actually use the recovered result(s) to recover the NN
+	// recover the serialized bucket retrieved from each database
+	// and dequantize the vectors of the ads it contains
+	candidateIDs := make([]int, 0)
+	candidates := make([]*vec.Vec, 0)
 	for dbIndex := 0; dbIndex < client.SessionParams.NumTableDBs; dbIndex++ {
-		elemIndex := allIndices[dbIndex]
-		c := client.TablePIRClient
+		parallelIndex, elemIndex := c.Params.ParallelIndex(dbItems[dbIndex])
 		offset := c.GetFVOffset(elemIndex)
-		c.Recover(qres.Answers[dbIndex][0], offset)
+		res := c.Recover(qres.Answers[dbIndex][parallelIndex], offset)
+
+		if !probed[dbIndex] || client.TableQuantizer == nil {
+			// arbitrary bucket or random tables
+			continue
+		}
+
+		itemBytes := int64(c.Params.ItemBytes)
+		bucket := res[offset*itemBytes : (offset+1)*itemBytes]
+
+		ids, vectors, err := anns.DecodeQuantizedBucket(bucket, client.TableQuantizer)
+		if err != nil {
+			panic(err)
+		}
+
+		candidateIDs = append(candidateIDs, ids...)
+		candidates = append(candidates, vectors...)
+	}
+
+	neighbors := RankCandidates(client.Profile, candidateIDs, candidates, client.SessionParams.Metric, k)
+
+	// keep the vectors of the selected ads for the auction (see RunAuction)
+	selected := make(map[int]bool)
+	for _, id := range neighbors {
+		selected[id] = true
+	}
+
+	client.CandidateVectors = make(map[int]*vec.Vec)
+	for i, id := range candidateIDs {
+		if selected[id] {
+			client.CandidateVectors[id] = candidates[i]
+		}
 	}
 
 	bandwidthNaive := qres.StatsNaiveBandwidthBytes
@@ -202,7 +346,105 @@ func (client *Client) QueryBuckets() ([][]int, int64, int64, int64, int64) {
 	bandwidthDown := getSizeInBytes(qres)
 	serverMS := qres.StatsTotalTimeInMS
 
-	return nil, serverMS, bandwidthUp, bandwidthDown, bandwidthNaive
+	return neighbors, serverMS, bandwidthUp, bandwidthDown, bandwidthNaive
+}
+
+// PrivateAdQuery privately retrieves the creative of the ad with the given ID
+// from the ad database. The same number of chunks is retrieved from each size
+// class for every ad (see adstore.Directory.QueryPlan). Returns the creative along
+// with the server processing time (in ms) and the upload and download bandwidth (in bytes).
+func (client *Client) PrivateAdQuery(adID int) ([]byte, int64, int64, int64) {
+
+	qargs := &api.AdQueryArgs{}
+	qres := &api.AdQueryResponse{}
+
+	dir := client.AdDirectory
+	if dir == nil {
+		panic("no ad database PIR params provided")
+	}
+
+	plan, err := dir.QueryPlan(adID)
+	if err != nil {
+		panic(err)
+	}
+
+	qargs.Queries = make(map[int][]*sealpir.Query)
+	for class, items := range plan {
+		c := client.AdPIRClients[class]
+
+		qargs.Queries[class] = make([]*sealpir.Query, len(items))
+		for i, item := range items {
+			_, elemIndex := c.Params.ParallelIndex(item)
+			qargs.Queries[class][i] = c.GenQuery(c.GetFVIndex(elemIndex))
+		}
+	}
+
+	if !client.call("Server.PrivateAdQuery", &qargs, &qres) {
+		panic("failed to make RPC call")
+	}
+
+	// only the chunks retrieved from the class of the ad are decrypted
+	class := dir.Locations[adID].Class
+	c := client.AdPIRClients[class]
+	itemBytes := int64(c.Params.ItemBytes)
+
+	chunks := make([][]byte, len(plan[class]))
+	for i, item := range plan[class] {
+		parallelIndex, elemIndex := c.Params.ParallelIndex(item)
+		offset := c.GetFVOffset(elemIndex)
+		res := c.Recover(qres.Answers[class][i][parallelIndex], offset)
+		chunks[i] = res[offset*itemBytes : (offset+1)*itemBytes]
+	}
+
+	creative, err := dir.Reassemble(adID, chunks)
+	if err != nil {
+		panic(err)
+	}
+
+	return creative, qres.StatsTotalTimeInMS, getSizeInBytes(qargs), getSizeInBytes(qres)
+}
+
+// AdQuery retrieves the creative of the ad with the given ID in the clear
+// (revealing the ad to the server). Returns the creative and the bandwidth (in bytes).
+func (client *Client) AdQuery(adID int) ([]byte, int64) {
+
+	qargs := &api.AdQueryArgs{Index: int64(adID)}
+	qres := &api.AdQueryResponse{}
+
+	if !client.call("Server.AdQuery", &qargs, &qres) {
+		panic("failed to make RPC call")
+	}
+
+	return qres.Item, getSizeInBytes(qargs) + getSizeInBytes(qres)
+}
+
+// RankCandidates returns the IDs of (at most) the k candidate ads closest to
+// the profile according to the metric, closest first. Ads retrieved more than
+// once (e.g., from several tables) are only considered once.
+func RankCandidates(profile *vec.Vec, ids []int, vectors []*vec.Vec, metric anns.DistanceMetric, k int) []int {
+
+	dist := anns.MetricDistance(metric)
+
+	distances := make(map[int]float64)
+	ranked := make([]int, 0, len(ids))
+	for i, id := range ids {
+		if _, ok := distances[id]; ok {
+			continue
+		}
+
+		distances[id] = dist(profile, vectors[i])
+		ranked = append(ranked, id)
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return distances[ranked[i]] < distances[ranked[j]]
+	})
+
+	if k < len(ranked) {
+		ranked = ranked[:k]
+	}
+
+	return ranked
 }
 
 func getSizeInBytes(s interface{}) int64 {
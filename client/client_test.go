@@ -0,0 +1,57 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/sachaservan/adveil/anns"
+
+	"github.com/sachaservan/vec"
+)
+
+func TestRankCandidates(t *testing.T) {
+
+	profile := vec.NewVec([]float64{0, 0})
+
+	// distance of each ad to the profile is its ID
+	vectors := map[int]*vec.Vec{
+		1: vec.NewVec([]float64{1, 0}),
+		2: vec.NewVec([]float64{0, 2}),
+		3: vec.NewVec([]float64{3, 0}),
+		4: vec.NewVec([]float64{0, 4}),
+		5: vec.NewVec([]float64{0, 1}),
+	}
+
+	tests := []struct {
+		name     string
+		ids      []int
+		k        int
+		expected []int
+	}{
+		{"top k", []int{4, 2, 3, 1}, 2, []int{1, 2}},
+		{"all candidates", []int{4, 2, 3, 1}, 4, []int{1, 2, 3, 4}},
+		{"k larger than candidates", []int{3, 1}, 10, []int{1, 3}},
+		{"k of zero", []int{3, 1}, 0, []int{}},
+		{"duplicates", []int{2, 1, 2, 1, 3}, 3, []int{1, 2, 3}},
+		{"duplicates beyond k", []int{1, 1, 1, 2}, 2, []int{1, 2}},
+		{"ties in order of retrieval", []int{3, 5, 1}, 2, []int{5, 1}},
+		{"no candidates", []int{}, 3, []int{}},
+	}
+
+	for _, test := range tests {
+		candidateVectors := make([]*vec.Vec, len(test.ids))
+		for i, id := range test.ids {
+			candidateVectors[i] = vectors[id]
+		}
+
+		ranked := RankCandidates(profile, test.ids, candidateVectors, anns.EuclideanDistance, test.k)
+		if len(ranked) != len(test.expected) {
+			t.Fatalf("%v: expected %v, got %v", test.name, test.expected, ranked)
+		}
+
+		for i := range ranked {
+			if ranked[i] != test.expected[i] {
+				t.Fatalf("%v: expected %v, got %v", test.name, test.expected, ranked)
+			}
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package client
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Impression of an ad shown to the client
+type Impression struct {
+	AdID       int       `json:"ad_id"`
+	CampaignID int       `json:"campaign_id"`
+	NoCampaign bool      `json:"no_campaign,omitempty"` // the ad has no (known) campaign
+	Time       time.Time `json:"time"`
+}
+
+// ImpressionStore records the impressions of the ads shown to the client
+// and is used to enforce frequency caps and rotate ads. The store is only
+// kept on the client (in a local file if a path is provided) and never sent to the broker.
+type ImpressionStore struct {
+	Window time.Duration // only impressions within the window count toward caps (all if 0)
+
+	// ads shown in the last Rotation impressions are left out of the
+	// auction as long as other candidates are eligible (no rotation if 0)
+	Rotation int
+
+	mu          sync.Mutex
+	path        string
+	impressions []*Impression
+}
+
+// OpenImpressionStore loads the impressions stored at path (if the file exists).
+// Impressions are only kept in memory if path is empty.
+func OpenImpressionStore(path string, window time.Duration) (*ImpressionStore, error) {
+
+	store := &ImpressionStore{
+		Window:      window,
+		path:        path,
+		impressions: make([]*Impression, 0),
+	}
+
+	if path == "" {
+		return store, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &store.impressions); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// Record adds an impression of the ad of the campaign at time t and persists the store
+func (store *ImpressionStore) Record(adID, campaignID int, t time.Time) error {
+	return store.add(&Impression{AdID: adID, CampaignID: campaignID, Time: t})
+}
+
+// RecordWithoutCampaign adds an impression of an ad without a campaign at time t
+// (which does not count toward the cap of any campaign) and persists the store
+func (store *ImpressionStore) RecordWithoutCampaign(adID int, t time.Time) error {
+	return store.add(&Impression{AdID: adID, NoCampaign: true, Time: t})
+}
+
+// add appends the impression to the store and persists it
+func (store *ImpressionStore) add(imp *Impression) error {
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.impressions = append(store.impressions, imp)
+	store.prune(imp.Time)
+
+	return store.save()
+}
+
+// prune drops the impressions that are outside the window
+func (store *ImpressionStore) prune(now time.Time) {
+
+	if store.Window <= 0 {
+		return
+	}
+
+	kept := store.impressions[:0]
+	for _, imp := range store.impressions {
+		if imp.Time.After(now.Add(-store.Window)) {
+			kept = append(kept, imp)
+		}
+	}
+	store.impressions = kept
+}
+
+// save writes the impressions to the file of the store (replacing it atomically)
+func (store *ImpressionStore) save() error {
+
+	if store.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(store.impressions)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(store.path), filepath.Base(store.path))
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), store.path)
+}
+
+// counts returns the number of impressions of each ad and campaign within the window
+// along with the position in the log of the last impression of each ad and the
+// number of impressions in the log
+func (store *ImpressionStore) counts(now time.Time) (map[int]int, map[int]int, map[int]int, int) {
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	ads := make(map[int]int)
+	campaigns := make(map[int]int)
+	lastShown := make(map[int]int)
+	for i, imp := range store.impressions {
+		lastShown[imp.AdID] = i
+
+		if store.Window > 0 && !imp.Time.After(now.Add(-store.Window)) {
+			continue
+		}
+
+		ads[imp.AdID]++
+		if !imp.NoCampaign {
+			campaigns[imp.CampaignID]++
+		}
+	}
+
+	return ads, campaigns, lastShown, len(store.impressions)
+}
+
+// EligibleAds returns the ads that have not reached the frequency cap of the ad
+// or of its campaign, leaving out the ads shown in the last Rotation impressions
+// (see ImpressionStore). If every such ad was shown recently, only the least
+// recently shown one is eligible so that the client rotates among the candidates.
+func (client *Client) EligibleAds(ads []int, now time.Time) []int {
+
+	if client.Impressions == nil {
+		return ads
+	}
+
+	adCounts, campaignCounts, lastShown, numShown := client.Impressions.counts(now)
+
+	capped := make([]int, 0, len(ads))
+	for _, id := range ads {
+		if limit, ok := client.AdCaps[id]; ok && adCounts[id] >= limit {
+			continue
+		}
+
+		if campaignID, ok := client.AdCampaigns[id]; ok {
+			if limit, ok := client.CampaignCaps[campaignID]; ok && campaignCounts[campaignID] >= limit {
+				continue
+			}
+		}
+
+		capped = append(capped, id)
+	}
+
+	eligible := make([]int, 0, len(capped))
+	leastRecent, foundRecent := 0, false
+	for _, id := range capped {
+		last, shown := lastShown[id]
+		if !shown || last < numShown-client.Impressions.Rotation {
+			eligible = append(eligible, id)
+		} else if !foundRecent || last < lastShown[leastRecent] {
+			leastRecent, foundRecent = id, true
+		}
+	}
+
+	if len(eligible) == 0 && foundRecent {
+		eligible = append(eligible, leastRecent)
+	}
+
+	return eligible
+}
+
+// RecordImpression records that the ad was shown to the client
+func (client *Client) RecordImpression(adID int, now time.Time) error {
+
+	if client.Impressions == nil {
+		return nil
+	}
+
+	campaignID, ok := client.AdCampaigns[adID]
+	if !ok {
+		return client.Impressions.RecordWithoutCampaign(adID, now)
+	}
+
+	return client.Impressions.Record(adID, campaignID, now)
+}
@@ -0,0 +1,176 @@
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sachaservan/vec"
+)
+
+func getTestAuctionClient(t *testing.T, rotation int) *Client {
+
+	store, err := OpenImpressionStore("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Rotation = rotation
+
+	return &Client{
+		Profile:          vec.NewVec([]float64{0, 0}),
+		AdBids:           map[int]float64{1: 10, 2: 5, 3: 1},
+		AdCampaigns:      map[int]int{1: 100, 2: 100, 3: 200},
+		CandidateVectors: map[int]*vec.Vec{1: vec.NewVec([]float64{1, 0}), 2: vec.NewVec([]float64{0, 1}), 3: vec.NewVec([]float64{1, 1})},
+		Impressions:      store,
+	}
+}
+
+// runTrials runs the auction over the same candidates in repeated
+// trials and returns the winner of each trial (-1 if there is none)
+func runTrials(t *testing.T, client *Client, numTrials int) []int {
+
+	auction := &Auction{Type: SecondPrice}
+	ads := []int{1, 2, 3}
+	now := time.Now()
+
+	winners := make([]int, numTrials)
+	for i := range winners {
+		now = now.Add(time.Minute)
+
+		res, err := client.RunAuction(auction, client.EligibleAds(ads, now))
+		if err == ErrNoWinner {
+			winners[i] = -1
+			continue
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		winners[i] = res.AdID
+		if err := client.RecordImpression(res.AdID, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return winners
+}
+
+func checkWinners(t *testing.T, winners, expected []int) {
+	for i := range expected {
+		if winners[i] != expected[i] {
+			t.Fatalf("expected winners %v, got %v", expected, winners)
+		}
+	}
+}
+
+func TestRotation(t *testing.T) {
+
+	// without rotation the highest bid always wins
+	checkWinners(t, runTrials(t, getTestAuctionClient(t, 0), 4), []int{1, 1, 1, 1})
+
+	// the last winner sits out the next auction
+	checkWinners(t, runTrials(t, getTestAuctionClient(t, 1), 6), []int{1, 2, 1, 2, 1, 2})
+
+	// the last two winners sit out the next auction
+	checkWinners(t, runTrials(t, getTestAuctionClient(t, 2), 6), []int{1, 2, 3, 1, 2, 3})
+
+	// every candidate was shown recently: the least recently shown one is eligible
+	checkWinners(t, runTrials(t, getTestAuctionClient(t, 5), 6), []int{1, 2, 3, 1, 2, 3})
+}
+
+func TestFrequencyCaps(t *testing.T) {
+
+	client := getTestAuctionClient(t, 0)
+	client.AdCaps = map[int]int{1: 2}
+	client.CampaignCaps = map[int]int{100: 3}
+
+	// ad 1 is capped after 2 impressions and campaign 100 (ads 1 and 2) after 3
+	checkWinners(t, runTrials(t, client, 6), []int{1, 1, 2, 3, 3, 3})
+
+	client = getTestAuctionClient(t, 0)
+	client.AdCaps = map[int]int{1: 1, 2: 1, 3: 1}
+	checkWinners(t, runTrials(t, client, 4), []int{1, 2, 3, -1})
+}
+
+func TestImpressionWithoutCampaign(t *testing.T) {
+
+	client := getTestAuctionClient(t, 0)
+	client.AdCampaigns = map[int]int{1: 0}
+	client.CampaignCaps = map[int]int{0: 1}
+
+	// ad 2 has no campaign and does not count toward the cap of campaign 0
+	now := time.Now()
+	if err := client.RecordImpression(2, now); err != nil {
+		t.Fatal(err)
+	}
+
+	eligible := client.EligibleAds([]int{1, 2}, now)
+	if len(eligible) != 2 {
+		t.Fatalf("expected ads 1 and 2 to be eligible, got %v", eligible)
+	}
+
+	if err := client.RecordImpression(1, now); err != nil {
+		t.Fatal(err)
+	}
+
+	eligible = client.EligibleAds([]int{1, 2}, now)
+	if len(eligible) != 1 || eligible[0] != 2 {
+		t.Fatalf("expected ad 1 to be capped, got eligible ads %v", eligible)
+	}
+}
+
+func TestFrequencyWindow(t *testing.T) {
+
+	client := getTestAuctionClient(t, 0)
+	client.AdCaps = map[int]int{1: 1}
+	client.Impressions.Window = time.Hour
+
+	now := time.Now()
+	if err := client.RecordImpression(1, now); err != nil {
+		t.Fatal(err)
+	}
+
+	eligible := client.EligibleAds([]int{1, 2}, now.Add(time.Minute))
+	if len(eligible) != 1 || eligible[0] != 2 {
+		t.Fatalf("expected ad 1 to be capped, got eligible ads %v", eligible)
+	}
+
+	eligible = client.EligibleAds([]int{1, 2}, now.Add(2*time.Hour))
+	if len(eligible) != 2 {
+		t.Fatalf("expected the cap of ad 1 to expire, got eligible ads %v", eligible)
+	}
+}
+
+func TestImpressionStorePersistence(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "impressions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "impressions.json")
+
+	store, err := OpenImpressionStore(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := store.Record(7, 1, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store, err = OpenImpressionStore(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ads, campaigns, _, _ := store.counts(now)
+	if ads[7] != 3 || campaigns[1] != 3 {
+		t.Fatalf("impressions were not persisted: %v %v", ads, campaigns)
+	}
+}
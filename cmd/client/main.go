@@ -20,26 +20,54 @@ import (
 var args struct {
 	ServerAddr          string
 	ServerPort          string
-	SecurityBits        int    `default:"1024"` // e.g., 1024 RSA security; 128 for secret-sharing security
-	ExperimentNumTrials int    `default:"1"`    // number of times to run this experiment configuration
-	ExperimentSaveFile  string `default:"output.json"`
-	AutoCloseClient     bool   `default:"true"` // close client when done
+	SecurityBits        int     `default:"1024"` // e.g., 1024 RSA security; 128 for secret-sharing security
+	ExperimentNumTrials int     `default:"1"`    // number of times to run this experiment configuration
+	ExperimentSaveFile  string  `default:"output.json"`
+	AutoCloseClient     bool    `default:"true"`         // close client when done
+	K                   int     `default:"1"`            // number of ads to select from the retrieved buckets
+	Auction             string  `default:"second-price"` // auction run over the selected ads: second-price or quality-weighted
+	Reserve             float64 `default:"0"`            // reserve price of the auction
+
+	// impressions are stored locally to enforce frequency caps (in memory only if empty)
+	ImpressionFile  string
+	FrequencyWindow time.Duration `default:"24h"` // window over which frequency caps apply (0 for no limit)
+	Rotation        int           `default:"1"`   // number of recent impressions whose ads sit out the auction
+
+	// also fetch an unrelated random ad in the clear to benchmark non-private retrieval
+	// (never the selected ad, which would reveal it to the broker)
+	NonPrivateBaseline bool `default:"false"`
 }
 
 func main() {
 
 	gob.Register(&anns.GaussianHash{})
+	gob.Register(&anns.BitSamplingHash{})
+	gob.Register(&anns.HyperplaneHash{})
+	gob.Register(&anns.MinHash{})
 
 	arg.MustParse(&args)
 
+	auctionType, err := client.ParseAuctionType(args.Auction)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	cli := &client.Client{}
 	cli.ServerAddr = args.ServerAddr
 	cli.ServerPort = args.ServerPort
 	cli.Experiment = &client.RuntimeExperiment{}
 
+	cli.Impressions, err = client.OpenImpressionStore(args.ImpressionFile, args.FrequencyWindow)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cli.Impressions.Rotation = args.Rotation
+
 	// init experiment
 	cli.Experiment.GetBucketServerMS = make([]int64, 0)
 	cli.Experiment.GetBucketClientMS = make([]int64, 0)
+	cli.Experiment.GetAdServerMS = make([]int64, 0)
+	cli.Experiment.GetAdClientMS = make([]int64, 0)
 
 	log.Printf("[Client]: waiting for server to initialize \n")
 
@@ -52,6 +80,12 @@ func main() {
 
 	cli.InitSession()
 
+	auction := &client.Auction{
+		Type:    auctionType,
+		Reserve: args.Reserve,
+		Metric:  cli.SessionParams.Metric,
+	}
+
 	log.Printf("[Client]: sending PIR keys to the server \n")
 
 	cli.SendPIRKeys()
@@ -62,7 +96,8 @@ func main() {
 	for i := 0; i < args.ExperimentNumTrials+experimentsToDiscard; i++ {
 
 		start := time.Now()
-		_, serverMS, bandwidthUp, bandwidthDown, bandwidthNaive := cli.QueryBuckets()
+		ads, serverMS, bandwidthUp, bandwidthDown, bandwidthNaive := cli.QueryBuckets(args.K)
+		log.Printf("[Client]: selected ads %v\n", ads)
 
 		if i >= experimentsToDiscard {
 			cli.Experiment.GetBucketClientMS = append(cli.Experiment.GetBucketClientMS, time.Now().Sub(start).Milliseconds())
@@ -74,6 +109,53 @@ func main() {
 			log.Printf("[Client]: bucket query took %v seconds\n", time.Now().Sub(start).Seconds())
 		}
 
+		if cli.AdDirectory != nil {
+			// fetch the winning ad (or an arbitrary one if there is no winner)
+			adID := 0
+			for id := range cli.AdDirectory.Locations {
+				adID = id
+				break
+			}
+
+			// ads that reached their frequency cap (or were just shown) sit out the auction
+			result, err := cli.RunAuction(auction, cli.EligibleAds(ads, time.Now()))
+			if err == nil {
+				adID = result.AdID
+				log.Printf("[Client]: ad %v won the auction at price %v\n", result.AdID, result.Price)
+
+				if err := cli.RecordImpression(adID, time.Now()); err != nil {
+					log.Fatal(err)
+				}
+			} else {
+				log.Printf("[Client]: %v\n", err)
+			}
+
+			start = time.Now()
+			_, serverMS, bandwidthUp, bandwidthDown := cli.PrivateAdQuery(adID)
+			privateMS := time.Now().Sub(start).Milliseconds()
+
+			var nonPrivateMS, bandwidth int64
+			if args.NonPrivateBaseline {
+				start = time.Now()
+				_, bandwidth = cli.AdQuery(randomAdID(cli))
+				nonPrivateMS = time.Now().Sub(start).Milliseconds()
+			}
+
+			if i >= experimentsToDiscard {
+				cli.Experiment.GetAdClientMS = append(cli.Experiment.GetAdClientMS, privateMS)
+				cli.Experiment.GetAdServerMS = append(cli.Experiment.GetAdServerMS, serverMS)
+				cli.Experiment.GetAdBandwidthUpB = append(cli.Experiment.GetAdBandwidthUpB, bandwidthUp)
+				cli.Experiment.GetAdBandwidthDownB = append(cli.Experiment.GetAdBandwidthDownB, bandwidthDown)
+				log.Printf("[Client]: ad query took %v ms\n", privateMS)
+
+				if args.NonPrivateBaseline {
+					cli.Experiment.GetAdNonPrivateClientMS = append(cli.Experiment.GetAdNonPrivateClientMS, nonPrivateMS)
+					cli.Experiment.GetAdNonPrivateBandwidthB = append(cli.Experiment.GetAdNonPrivateBandwidthB, bandwidth)
+					log.Printf("[Client]: non-private ad query took %v ms\n", nonPrivateMS)
+				}
+			}
+		}
+
 		if i >= experimentsToDiscard {
 			log.Printf("[Client]: finished trial %v of %v \n", i+1-experimentsToDiscard, args.ExperimentNumTrials)
 		} else {
@@ -97,6 +179,22 @@ func main() {
 	cli.TerminateSessions()
 }
 
+// randomAdID returns the ID of a uniformly random ad in the ad directory
+func randomAdID(cli *client.Client) int {
+
+	ids := make([]int, 0, len(cli.AdDirectory.Locations))
+	for id := range cli.AdDirectory.Locations {
+		ids = append(ids, id)
+	}
+
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(len(ids))))
+	if err != nil {
+		panic(err)
+	}
+
+	return ids[i.Int64()]
+}
+
 func randomPrime(bits int) *big.Int {
 	for {
 		p, err := rand.Prime(rand.Reader, bits)
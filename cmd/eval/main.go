@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"math/rand"
+
+	"github.com/sachaservan/adveil/anns"
+	"github.com/sachaservan/adveil/client"
+	"github.com/sachaservan/adveil/dataset"
+
+	"github.com/alexflint/go-arg"
+	"github.com/sachaservan/vec"
+)
+
+func main() {
+
+	// command-line arguments to the evaluation
+	var args struct {
+		// database parameters
+		NumCategories int `default:"10000"`
+		NumProcs      int `default:"40"` // parallelism of the server (partitions are padded to a multiple of it)
+
+		// knn parameters
+		NumFeatures     int    `default:"50"`
+		NumTables       int    `default:"5"`
+		NumProbes       int    `default:"15"`
+		NumProjections  int    `default:"5"`
+		DataMin         int    `default:"-50"`
+		DataMax         int    `default:"50"`
+		ProjectionWidth int    `default:"300"`
+		BucketSize      int    `default:"1"`
+		Overflow        string `default:"drop"`      // policy for full buckets: one of drop, reservoir, spill
+		Metric          string `default:"euclidean"` // one of hamming, euclidean, angular, jaccard
+
+		// query parameters
+		NumQueries int `default:"100"`
+		K          int `default:"1"`
+		QueryNoise int `default:"5"` // max perturbation of each coordinate of a data point to obtain a query
+
+		// evaluate over a dataset (fvecs, bvecs, ivecs, csv, or json) instead of
+		// random data; overrides NumCategories and NumFeatures
+		DataFile        string
+		DataLimit       int    `default:"0"` // max number of values to load (0 for all)
+		QueryFile       string // queries (otherwise perturbed data points are used)
+		GroundTruthFile string // ivecs file of exact neighbors of each query
+
+		ExperimentSaveFile string `default:"accuracy.json"`
+	}
+
+	arg.MustParse(&args)
+
+	var err error
+	var ds *dataset.Dataset
+	if args.DataFile != "" {
+		ds, err = dataset.Load(args.DataFile, args.DataLimit)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		args.NumCategories = len(ds.Vectors)
+		args.NumFeatures = ds.NumFeatures()
+	}
+
+	params := &anns.LSHParams{}
+	params.NumFeatures = args.NumFeatures
+	params.NumProjections = args.NumProjections
+	params.ProjectionWidth = float64(args.ProjectionWidth)
+	params.NumTables = args.NumTables
+	params.NumProbes = args.NumProbes
+	params.BucketSize = args.BucketSize
+	params.HashBytes = 4
+	params.Metric, err = anns.ParseDistanceMetric(args.Metric)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// same number of buckets per table as the server
+	// (see server.BuildKNNDataStructure)
+	params.NumBuckets = anns.PartitionedNumBuckets(args.NumCategories, args.NumProbes, args.NumProcs)
+
+	binary := params.Metric == anns.HammingDistance || params.Metric == anns.JaccardDistance
+
+	dataMin, dataMax := float64(args.DataMin), float64(args.DataMax)
+	if binary {
+		dataMin, dataMax = 0, 1
+	}
+
+	var data []*vec.Vec
+	if ds != nil {
+		data = ds.Vectors
+	} else {
+		data = make([]*vec.Vec, args.NumCategories)
+		for i := range data {
+			data[i] = vec.NewRandomVec(args.NumFeatures, dataMin, dataMax)
+		}
+	}
+
+	var groundTruth [][]int
+	if args.GroundTruthFile != "" {
+		groundTruth, err = dataset.LoadGroundTruth(args.GroundTruthFile, args.NumQueries)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var queries []*vec.Vec
+	if args.QueryFile != "" {
+		qs, err := dataset.Load(args.QueryFile, args.NumQueries)
+		if err != nil {
+			log.Fatal(err)
+		}
+		queries = qs.Vectors
+	}
+
+	if groundTruth != nil && len(groundTruth) < len(queries) {
+		log.Fatal("ground truth does not cover all queries")
+	}
+
+	// the (first K) exact neighbors must be in the loaded data (see DataLimit)
+	for _, neighbors := range groundTruth {
+		for j, index := range neighbors {
+			if j < args.K && (index < 0 || index >= len(data)) {
+				log.Fatalf("ground-truth neighbor %v is not in the %v loaded values", index, len(data))
+			}
+		}
+	}
+
+	if queries == nil {
+		// queries are perturbed data points
+		queries = make([]*vec.Vec, args.NumQueries)
+		for i := range queries {
+			queries[i] = data[i%len(data)].Copy()
+			if binary {
+				// flip a random coordinate
+				j := rand.Intn(args.NumFeatures)
+				queries[i].SetValueToCoord(1-queries[i].Coord(j), j)
+			} else if args.QueryNoise > 0 {
+				queries[i].Add(vec.NewRandomVec(args.NumFeatures, -float64(args.QueryNoise), float64(args.QueryNoise)))
+			}
+		}
+	}
+
+	log.Println("[Eval]: building targeting data struct")
+
+	knn, err := anns.NewLSHBased(params)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	knn.OverflowPolicy, err = anns.ParseOverflowPolicy(args.Overflow, params)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = knn.BuildWithData(data, params.BucketSize)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Println("[Eval]: running queries")
+
+	experiment, err := client.EvaluateAccuracy(knn, queries, args.K, groundTruth)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	recall := 0.0
+	for _, r := range experiment.RecallAtK {
+		recall += r
+	}
+	log.Printf("[Eval]: average recall@%v = %.3f\n", args.K, recall/float64(len(queries)))
+
+	// write the result of the evalaution to the specified file
+	experimentJSON, _ := json.MarshalIndent(experiment, "", " ")
+	ioutil.WriteFile(args.ExperimentSaveFile, experimentJSON, 0644)
+}
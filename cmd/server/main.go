@@ -1,17 +1,22 @@
 package main
 
 import (
+	"bufio"
 	"encoding/gob"
 	"log"
 	"net"
 	"net/http"
 	"net/rpc"
+	"os"
 	"time"
 
 	"github.com/sachaservan/adveil/anns"
+	"github.com/sachaservan/adveil/catalog"
+	"github.com/sachaservan/adveil/dataset"
 	"github.com/sachaservan/adveil/server"
 
 	"github.com/alexflint/go-arg"
+	"github.com/sachaservan/vec"
 )
 
 // MetricsExperiment contains results for verifying tokens
@@ -25,6 +30,9 @@ type MetricsExperiment struct {
 func main() {
 
 	gob.Register(&anns.GaussianHash{})
+	gob.Register(&anns.BitSamplingHash{})
+	gob.Register(&anns.HyperplaneHash{})
+	gob.Register(&anns.MinHash{})
 
 	// command-line arguments to the server
 	var args struct {
@@ -37,15 +45,45 @@ func main() {
 		// database parameters
 		NumCategories int `default:"10000"`
 		AdSizeBytes   int `default:"1000"`
+		AdChunkBytes  int `default:"0"` // bytes per PIR item of the ad creatives (largest possible if 0)
 
 		// knn parameters
-		NumFeatures     int `default:"50"`
-		NumTables       int `default:"5"`
-		NumProbes       int `default:"15"`
-		NumProjections  int `default:"5"`
-		DataMin         int `default:"-50"`
-		DataMax         int `default:"50"`
-		ProjectionWidth int `default:"300"`
+		NumFeatures     int    `default:"50"`
+		NumTables       int    `default:"5"`
+		NumProbes       int    `default:"15"`
+		NumProjections  int    `default:"5"`
+		DataMin         int    `default:"-50"`
+		DataMax         int    `default:"50"`
+		ProjectionWidth int    `default:"300"`
+		Metric          string `default:"euclidean"` // one of hamming, euclidean, angular, jaccard
+		HashSeed        int64  `default:"0"`         // derive the hash functions from a seed (random if 0)
+		BucketSize      int    `default:"1"`         // max number of values in each bucket
+		Overflow        string `default:"drop"`      // policy for full buckets: one of drop, reservoir, spill, bid (requires a catalog)
+
+		// build the tables from (randomly generated) data points
+		// rather than filling them with random bytes
+		RealTables bool `default:"false"`
+
+		// build the tables from a dataset (fvecs, bvecs, ivecs, csv, or json)
+		// instead of random data; overrides NumCategories and NumFeatures
+		DataFile  string
+		DataLimit int `default:"0"` // max number of values to load (0 for all)
+
+		// serve the ads of a (JSON) catalog: the tables and the ad database
+		// are built from its targeting vectors and creatives; overrides DataFile
+		CatalogFile string
+
+		// write a snapshot of the targeting data structure and
+		// table databases after building them, or boot from one
+		SnapshotOut string
+		SnapshotIn  string
+
+		// tune the knn parameters on a sample of the data (requires RealTables)
+		Tune           bool    `default:"false"`
+		TuneRecall     float64 `default:"0.8"`
+		TuneK          int     `default:"1"`
+		TuneSampleSize int     `default:"1000"`
+		TuneNumQueries int     `default:"100"`
 
 		// only for reporting experiment
 		JustReporting       bool   `default:"false"`
@@ -58,35 +96,146 @@ func main() {
 	// parse the command line arguments
 	arg.MustParse(&args)
 
+	var cat *catalog.Catalog
+	var ds *dataset.Dataset
+	if args.CatalogFile != "" {
+		log.Println("[Server]: loading catalog from " + args.CatalogFile)
+
+		var err error
+		cat, err = catalog.Load(args.CatalogFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		args.NumCategories = len(cat.Ads)
+		args.NumFeatures = cat.NumFeatures()
+		args.RealTables = true
+	} else if args.DataFile != "" {
+		log.Println("[Server]: loading data from " + args.DataFile)
+
+		var err error
+		ds, err = dataset.Load(args.DataFile, args.DataLimit)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		args.NumCategories = len(ds.Vectors)
+		args.NumFeatures = ds.NumFeatures()
+		args.RealTables = true
+	}
+
 	// construct the parameter struct for KNN data structure
+	var err error
 	params := &anns.LSHParams{}
 	params.NumFeatures = args.NumFeatures
 	params.NumProjections = args.NumProjections
 	params.ProjectionWidth = float64(args.ProjectionWidth)
 	params.NumTables = args.NumTables
 	params.NumProbes = args.NumProbes
-	params.Metric = anns.EuclideanDistance
+	params.Seed = args.HashSeed
+	params.Metric, err = anns.ParseDistanceMetric(args.Metric)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// TODO: don't have magic constants
 	params.ApproximationFactor = 2 // NOT USED
-	params.BucketSize = 1
+	params.BucketSize = args.BucketSize
 	params.HashBytes = 4
 
+	var overflowPolicy anns.OverflowPolicy
+	if args.Overflow == "bid" {
+		if cat == nil {
+			log.Fatal("the bid overflow policy requires a catalog (--catalogfile)")
+		}
+
+		// bids are set from the catalog (see server.BuildKNNDataStructure)
+		overflowPolicy = &anns.LowestBidPolicy{}
+	} else {
+		overflowPolicy, err = anns.ParseOverflowPolicy(args.Overflow, params)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	// make the server struct
 	serv := &server.Server{
-		Sessions:      make(map[int64]*server.ClientSession),
-		KnnParams:     params,
-		Ready:         false,
-		NumCategories: args.NumCategories,
-		NumProcs:      args.NumProcs,
+		Sessions:          make(map[int64]*server.ClientSession),
+		KnnParams:         params,
+		KnnOverflowPolicy: overflowPolicy,
+		Ready:             false,
+		NumCategories:     args.NumCategories,
+		NumProcs:          args.NumProcs,
+		Catalog:           cat,
+		AdSizeBytes:       args.AdSizeBytes,
+		AdChunkBytes:      args.AdChunkBytes,
+	}
+
+	if args.Tune && !args.RealTables {
+		log.Fatal("tuning requires building the tables from data (--realtables or --datafile)")
+	}
+
+	if cat != nil {
+		serv.KnnValues = cat.Vectors()
+		serv.KnnIDs = cat.IDs()
+	} else if ds != nil {
+		serv.KnnValues = ds.Vectors
+		serv.KnnIDs = ds.IDs
+	} else if args.RealTables {
+		dataMin, dataMax := float64(args.DataMin), float64(args.DataMax)
+		if params.Metric == anns.HammingDistance || params.Metric == anns.JaccardDistance {
+			// binary vectors (sets are represented as indicator vectors)
+			dataMin, dataMax = 0, 1
+		}
+
+		serv.KnnValues = make([]*vec.Vec, args.NumCategories)
+		for i := range serv.KnnValues {
+			serv.KnnValues[i] = vec.NewRandomVec(args.NumFeatures, dataMin, dataMax)
+		}
 	}
 
 	go func(serv *server.Server) {
 		// hack to ensure server starts before this completes
 		time.Sleep(100 * time.Millisecond)
 
-		log.Println("[Server]: building fake targeting data struct")
-		server.BuildKNNDataStructure(serv)
+		if args.SnapshotIn != "" {
+			log.Println("[Server]: loading targeting data struct from " + args.SnapshotIn)
+			err := loadSnapshot(serv, args.SnapshotIn)
+			if err != nil {
+				log.Fatal(err)
+			}
+		} else {
+			if args.Tune {
+				log.Println("[Server]: tuning targeting parameters")
+				err := server.TuneKNNParams(serv, args.TuneRecall, args.TuneK, args.TuneSampleSize, args.TuneNumQueries)
+				if err != nil {
+					log.Fatal(err)
+				}
+			}
+
+			if serv.KnnValues != nil {
+				log.Println("[Server]: building targeting data struct")
+			} else {
+				log.Println("[Server]: building fake targeting data struct")
+			}
+			err := server.BuildKNNDataStructure(serv)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if serv.AdDirectory == nil {
+			log.Println("[Server]: building ad database")
+			server.BuildAdDatabase(serv)
+		}
+
+		if args.SnapshotOut != "" {
+			log.Println("[Server]: writing targeting data struct to " + args.SnapshotOut)
+			err := writeSnapshot(serv, args.SnapshotOut)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
 
 		log.Println("[Server]: server is ready")
 		serv.Ready = true
@@ -99,6 +248,35 @@ func main() {
 	startServer(serv, args.Port)
 }
 
+func loadSnapshot(serv *server.Server, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return server.LoadSnapshot(serv, bufio.NewReader(f))
+}
+
+func writeSnapshot(serv *server.Server, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	err = server.WriteSnapshot(serv, w)
+	if err == nil {
+		err = w.Flush()
+	}
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
 // kill server when Killed flag set
 func killLoop(serv *server.Server) {
 	for !serv.Killed {
@@ -0,0 +1,399 @@
+package dataset
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sachaservan/adveil/catalog"
+
+	"github.com/sachaservan/vec"
+)
+
+// Format of a vector file
+type Format int
+
+const (
+	// FVecs is a sequence of (int32 dim, dim x float32) records
+	FVecs Format = iota
+	// BVecs is a sequence of (int32 dim, dim x uint8) records
+	BVecs
+	// IVecs is a sequence of (int32 dim, dim x int32) records
+	// (typically used for ground-truth neighbor indices)
+	IVecs
+	// CSV is an ad catalog with one "id,x1,...,xd" row per ad
+	// (a header row is skipped if the id column is not an integer)
+	CSV
+	// JSON is an ad catalog consisting of an array of {"id": ..., "vector": [...]} objects
+	JSON
+)
+
+// Dataset is a set of vectors, each associated with an (ad) ID
+type Dataset struct {
+	IDs     []int
+	Vectors []*vec.Vec
+}
+
+// jsonEntry is an entry of a JSON ad catalog
+type jsonEntry struct {
+	ID     int       `json:"id"`
+	Vector []float64 `json:"vector"`
+}
+
+// MaxVecsDim is the largest vector dimension accepted by VecsReader
+// (larger dimensions are likely due to a corrupt or mismatched file)
+const MaxVecsDim = 1 << 16
+
+// VecsReader streams vectors from a file in the
+// fvecs, bvecs, or ivecs format used by ANN benchmarks
+// see http://corpus-texmex.irisa.fr/ for details on the format
+type VecsReader struct {
+	r      *bufio.Reader
+	format Format
+	dim    int32 // dimension of the first vector (-1 before it is read)
+}
+
+// FormatFromPath infers the format of a file from its extension
+func FormatFromPath(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".fvecs":
+		return FVecs, nil
+	case ".bvecs":
+		return BVecs, nil
+	case ".ivecs":
+		return IVecs, nil
+	case ".csv":
+		return CSV, nil
+	case ".json":
+		return JSON, nil
+	default:
+		return 0, errors.New("unknown dataset format for " + path)
+	}
+}
+
+// NewVecsReader returns a reader of vectors in the given format from r
+func NewVecsReader(r io.Reader, format Format) (*VecsReader, error) {
+
+	if format != FVecs && format != BVecs && format != IVecs {
+		return nil, errors.New("format is not a vecs format")
+	}
+
+	return &VecsReader{bufio.NewReader(r), format, -1}, nil
+}
+
+// Next returns the next vector in the stream or io.EOF if there are none left.
+// Every vector must have the same dimension as the first one (at most MaxVecsDim).
+func (reader *VecsReader) Next() (*vec.Vec, error) {
+
+	var dim int32
+	err := binary.Read(reader.r, binary.LittleEndian, &dim)
+	if err != nil {
+		// io.EOF if the stream ended on a record boundary
+		return nil, err
+	}
+
+	if dim < 0 {
+		return nil, errors.New("negative vector dimension")
+	}
+
+	if dim > MaxVecsDim {
+		return nil, errors.New("vector dimension exceeds the max dimension")
+	}
+
+	if reader.dim >= 0 && dim != reader.dim {
+		return nil, errors.New("vectors have different dimensions")
+	}
+	reader.dim = dim
+
+	coords := make([]float64, dim)
+	switch reader.format {
+	case FVecs:
+		buf := make([]float32, dim)
+		err = binary.Read(reader.r, binary.LittleEndian, buf)
+		for i, c := range buf {
+			coords[i] = float64(c)
+		}
+	case BVecs:
+		buf := make([]uint8, dim)
+		_, err = io.ReadFull(reader.r, buf)
+		for i, c := range buf {
+			coords[i] = float64(c)
+		}
+	case IVecs:
+		buf := make([]int32, dim)
+		err = binary.Read(reader.r, binary.LittleEndian, buf)
+		for i, c := range buf {
+			coords[i] = float64(c)
+		}
+	}
+
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return vec.NewVec(coords), nil
+}
+
+// NextInts returns the next vector in the stream as integers
+// (e.g., ground-truth neighbor indices in an ivecs file)
+func (reader *VecsReader) NextInts() ([]int, error) {
+
+	v, err := reader.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]int, v.Size())
+	for i, c := range v.Coords {
+		res[i] = int(c)
+	}
+
+	return res, nil
+}
+
+// Load reads (up to) limit vectors from the file at path
+// (no limit if limit <= 0); the format is inferred from the file extension.
+// Vectors in vecs files are assigned their index in the file as ID.
+func Load(path string, limit int) (*Dataset, error) {
+
+	format, err := FormatFromPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var ds *Dataset
+	switch format {
+	case CSV:
+		ds, err = ReadCSV(f, limit)
+	case JSON:
+		ds, err = ReadJSON(f, limit)
+	default:
+		ds, err = ReadVecs(f, format, limit)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ds.Vectors) == 0 {
+		return nil, errors.New("dataset is empty")
+	}
+
+	return ds, nil
+}
+
+// LoadGroundTruth reads (up to) limit neighbor lists from an ivecs file
+func LoadGroundTruth(path string, limit int) ([][]int, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader, err := NewVecsReader(f, IVecs)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([][]int, 0)
+	for limit <= 0 || len(res) < limit {
+		neighbors, err := reader.NextInts()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, neighbors)
+	}
+
+	return res, nil
+}
+
+// ReadVecs reads (up to) limit vectors in a vecs format from r
+func ReadVecs(r io.Reader, format Format, limit int) (*Dataset, error) {
+
+	reader, err := NewVecsReader(r, format)
+	if err != nil {
+		return nil, err
+	}
+
+	ds := &Dataset{IDs: make([]int, 0), Vectors: make([]*vec.Vec, 0)}
+	for limit <= 0 || len(ds.Vectors) < limit {
+		v, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		ds.IDs = append(ds.IDs, len(ds.Vectors))
+		ds.Vectors = append(ds.Vectors, v)
+	}
+
+	return ds, nil
+}
+
+// ReadCSV reads (up to) limit ads from a CSV catalog
+func ReadCSV(r io.Reader, limit int) (*Dataset, error) {
+
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1 // dimensions are checked below
+
+	ds := &Dataset{IDs: make([]int, 0), Vectors: make([]*vec.Vec, 0)}
+	seen := make(map[int]bool)
+	for row := 0; limit <= 0 || len(ds.Vectors) < limit; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		id, err := strconv.Atoi(record[0])
+		if err != nil {
+			if row == 0 {
+				// header row
+				continue
+			}
+			return nil, err
+		}
+
+		coords := make([]float64, len(record)-1)
+		for i := range coords {
+			coords[i], err = strconv.ParseFloat(record[i+1], 64)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if err := ds.addAd(seen, id, coords); err != nil {
+			return nil, err
+		}
+	}
+
+	return ds, nil
+}
+
+// ReadJSON reads (up to) limit ads from a JSON catalog
+func ReadJSON(r io.Reader, limit int) (*Dataset, error) {
+
+	dec := json.NewDecoder(r)
+
+	// opening bracket of the array
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok != json.Delim('[') {
+		return nil, errors.New("JSON catalog is not an array")
+	}
+
+	ds := &Dataset{IDs: make([]int, 0), Vectors: make([]*vec.Vec, 0)}
+	seen := make(map[int]bool)
+	for dec.More() && (limit <= 0 || len(ds.Vectors) < limit) {
+		entry := jsonEntry{}
+		if err := dec.Decode(&entry); err != nil {
+			return nil, err
+		}
+
+		if err := ds.addAd(seen, entry.ID, entry.Vector); err != nil {
+			return nil, err
+		}
+	}
+
+	return ds, nil
+}
+
+// addAd appends the ad with the given ID and vector to the dataset.
+// IDs must be valid catalog IDs (see catalog.Validate) not in seen.
+func (ds *Dataset) addAd(seen map[int]bool, id int, coords []float64) error {
+
+	if id < 0 {
+		return fmt.Errorf("ad %v has a negative ID", id)
+	}
+
+	if int64(id) > catalog.MaxAdID {
+		return fmt.Errorf("ad %v has an ID larger than %v", id, catalog.MaxAdID)
+	}
+
+	if seen[id] {
+		return fmt.Errorf("duplicate ad ID %v", id)
+	}
+
+	if len(coords) == 0 {
+		return fmt.Errorf("ad %v has an empty vector", id)
+	}
+
+	if len(ds.Vectors) > 0 && len(coords) != ds.Vectors[0].Size() {
+		return errors.New("vectors have different dimensions")
+	}
+
+	seen[id] = true
+	ds.IDs = append(ds.IDs, id)
+	ds.Vectors = append(ds.Vectors, vec.NewVec(coords))
+
+	return nil
+}
+
+// WriteVecs writes the vectors to w in the given vecs format
+func WriteVecs(w io.Writer, format Format, vectors []*vec.Vec) error {
+
+	for _, v := range vectors {
+		err := binary.Write(w, binary.LittleEndian, int32(v.Size()))
+		if err != nil {
+			return err
+		}
+
+		for _, c := range v.Coords {
+			switch format {
+			case FVecs:
+				err = binary.Write(w, binary.LittleEndian, float32(c))
+			case BVecs:
+				err = binary.Write(w, binary.LittleEndian, uint8(math.Round(c)))
+			case IVecs:
+				err = binary.Write(w, binary.LittleEndian, int32(math.Round(c)))
+			default:
+				err = errors.New("format is not a vecs format")
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// NumFeatures returns the dimension of the vectors in the dataset
+func (ds *Dataset) NumFeatures() int {
+	if len(ds.Vectors) == 0 {
+		return 0
+	}
+	return ds.Vectors[0].Size()
+}
@@ -0,0 +1,210 @@
+package dataset
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sachaservan/vec"
+)
+
+func getTestVectors(n, dim int) []*vec.Vec {
+	vectors := make([]*vec.Vec, n)
+	for i := range vectors {
+		vectors[i] = vec.NewRandomVec(dim, 0, 255)
+	}
+	return vectors
+}
+
+func TestReadWriteVecs(t *testing.T) {
+	vectors := getTestVectors(100, 16)
+
+	for _, format := range []Format{FVecs, BVecs, IVecs} {
+		var buf bytes.Buffer
+		if err := WriteVecs(&buf, format, vectors); err != nil {
+			t.Fatal(err)
+		}
+
+		ds, err := ReadVecs(&buf, format, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(ds.Vectors) != len(vectors) || ds.NumFeatures() != 16 {
+			t.Fatalf("expected %v vectors of dim 16, got %v of dim %v", len(vectors), len(ds.Vectors), ds.NumFeatures())
+		}
+
+		for i := range vectors {
+			if !ds.Vectors[i].Equal(vectors[i]) || ds.IDs[i] != i {
+				t.Fatalf("vector %v was not recovered correctly (format %v)", i, format)
+			}
+		}
+	}
+}
+
+func TestReadVecsLimit(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteVecs(&buf, FVecs, getTestVectors(100, 8)); err != nil {
+		t.Fatal(err)
+	}
+
+	ds, err := ReadVecs(&buf, FVecs, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ds.Vectors) != 10 {
+		t.Fatalf("expected 10 vectors, got %v", len(ds.Vectors))
+	}
+}
+
+func TestReadVecsTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteVecs(&buf, FVecs, getTestVectors(2, 8)); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+	_, err := ReadVecs(bytes.NewReader(data[:len(data)-3]), FVecs, 0)
+	if err == nil {
+		t.Fatalf("expected an error for a truncated file")
+	}
+}
+
+func TestReadVecsDimensions(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteVecs(&buf, IVecs, getTestVectors(2, 8)); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteVecs(&buf, IVecs, getTestVectors(2, 4)); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := NewVecsReader(&buf, IVecs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := reader.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := reader.Next(); err == nil {
+		t.Fatalf("expected an error for a vector of a different dimension")
+	}
+
+	// header of a vector larger than the max dimension
+	header := []byte{0, 0, 0, 0x40}
+	_, err = ReadVecs(bytes.NewReader(header), FVecs, 0)
+	if err == nil {
+		t.Fatalf("expected an error for a vector larger than the max dimension")
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	data := "id,x1,x2,x3\n7,1.5,2,3\n9, -1, 0, 4.25\n"
+
+	ds, err := ReadCSV(strings.NewReader(data), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ds.IDs) != 2 || ds.IDs[0] != 7 || ds.IDs[1] != 9 {
+		t.Fatalf("wrong ids: %v", ds.IDs)
+	}
+
+	if !ds.Vectors[1].Equal(vec.NewVec([]float64{-1, 0, 4.25})) {
+		t.Fatalf("wrong vector: %v", ds.Vectors[1].Coords)
+	}
+}
+
+func TestReadJSON(t *testing.T) {
+	data := `[{"id": 3, "vector": [1, 2]}, {"id": 5, "vector": [3, 4]}]`
+
+	ds, err := ReadJSON(strings.NewReader(data), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ds.IDs) != 2 || ds.IDs[1] != 5 || !ds.Vectors[1].Equal(vec.NewVec([]float64{3, 4})) {
+		t.Fatalf("catalog was not read correctly")
+	}
+
+	for _, invalid := range []string{`{"id": 3, "vector": [1, 2]}`, `3`, `"ads"`} {
+		if _, err := ReadJSON(strings.NewReader(invalid), 0); err == nil {
+			t.Fatalf("expected an error for catalog %v that is not an array", invalid)
+		}
+	}
+}
+
+func TestReadInvalidIDs(t *testing.T) {
+	for _, data := range []string{"-1,1,2\n", "3,1,2\n3,3,4\n", "4294967296,1,2\n", "3\n"} {
+		if _, err := ReadCSV(strings.NewReader(data), 0); err == nil {
+			t.Fatalf("expected an error for CSV catalog %q", data)
+		}
+	}
+
+	for _, data := range []string{
+		`[{"id": -1, "vector": [1, 2]}]`,
+		`[{"id": 3, "vector": [1, 2]}, {"id": 3, "vector": [3, 4]}]`,
+		`[{"id": 4294967296, "vector": [1, 2]}]`,
+		`[{"id": 3, "vector": []}]`,
+	} {
+		if _, err := ReadJSON(strings.NewReader(data), 0); err == nil {
+			t.Fatalf("expected an error for JSON catalog %v", data)
+		}
+	}
+}
+
+func TestLoadEmpty(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dataset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{"ads.csv": "id,x1,x2\n", "ads.json": "[]", "ads.fvecs": ""}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := Load(path, 0); err == nil {
+			t.Fatalf("expected an error for empty dataset %v", name)
+		}
+	}
+}
+
+func TestLoadGroundTruth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dataset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "groundtruth.ivecs")
+	neighbors := []*vec.Vec{vec.NewVec([]float64{4, 1, 2}), vec.NewVec([]float64{0, 3, 5})}
+
+	var buf bytes.Buffer
+	if err := WriteVecs(&buf, IVecs, neighbors); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := LoadGroundTruth(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res) != 2 || res[0][0] != 4 || res[1][2] != 5 {
+		t.Fatalf("ground truth was not read correctly: %v", res)
+	}
+}
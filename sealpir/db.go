@@ -25,3 +25,22 @@ func InitRandomDB(params *Params) ([]byte, *Database) {
 
 	return data, db
 }
+
+// InitDB initializes a database holding data, which is
+// zero padded (or truncated) to NumItems * ItemBytes bytes
+func InitDB(params *Params, data []byte) *Database {
+
+	server := InitServer(params)
+
+	bytes := make([]byte, params.NumItems*params.ItemBytes)
+	copy(bytes, data)
+
+	db := &Database{
+		Server: server,
+		Bytes:  bytes,
+	}
+
+	server.SetupDatabase(db)
+
+	return db
+}
@@ -6,6 +6,7 @@ package sealpir
 // #include "../C/wrapper.h"
 import "C"
 import (
+	"errors"
 	"math"
 	"sync"
 	"unsafe"
@@ -100,6 +101,62 @@ func (server *Server) SetupDatabase(db *Database) {
 
 }
 
+// UpdateItems returns a copy of db in which the items at the given indices are
+// replaced (and zero padded). Only the parallel databases holding an updated item
+// are set up (preprocessed) again; the others are shared with db.
+// The galois keys are set on the databases that are set up again.
+func (db *Database) UpdateItems(items map[int64][]byte, keys []*GaloisKeys) (*Database, error) {
+
+	params := db.Server.Params
+	itemBytes := params.ItemBytes
+
+	bytes := make([]byte, len(db.Bytes))
+	copy(bytes, db.Bytes)
+
+	dirty := make(map[int]bool)
+	for index, item := range items {
+		if index < 0 || index >= int64(params.NumItems) {
+			return nil, errors.New("item index is out of range")
+		}
+
+		if len(item) > itemBytes {
+			return nil, errors.New("item is larger than the item size")
+		}
+
+		start := index * int64(itemBytes)
+		end := start + int64(itemBytes)
+		copy(bytes[start:end], make([]byte, itemBytes))
+		copy(bytes[start:end], item)
+
+		parallelIndex, _ := params.ParallelIndex(index)
+		dirty[parallelIndex] = true
+	}
+
+	server := &Server{
+		DBs:    make([]unsafe.Pointer, params.NParallelism),
+		Params: params,
+	}
+	copy(server.DBs, db.Server.DBs)
+
+	// same split into sub-databases as SetupDatabase
+	partsize := itemBytes * int(math.Ceil(float64(len(bytes)/itemBytes/params.NParallelism)))
+
+	for i := range dirty {
+		chunkBytes := bytes[i*partsize : i*partsize+partsize]
+		server.DBs[i] = C.init_server_wrapper(params.Pointer)
+		C.setup_database(server.DBs[i], C.CString(string(chunkBytes)))
+
+		for _, k := range keys {
+			setGaloisKeys(server.DBs[i], k)
+		}
+	}
+
+	return &Database{
+		Server: server,
+		Bytes:  bytes,
+	}, nil
+}
+
 func (client *Client) GenGaloisKeys() *GaloisKeys {
 	keyPtr := C.gen_galois_keys(client.Pointer)
 	keyC := (*GaloisKeysCStruct)(unsafe.Pointer(keyPtr))
@@ -142,6 +199,49 @@ func (server *Server) GenAnswerWithExpandedQuery(expandedQuery *ExpandedQuery) [
 	return answers
 }
 
+// ParallelIndex returns the index of the parallel database holding
+// item elemIndex and the index of the item within that database
+func (params *Params) ParallelIndex(elemIndex int64) (int, int64) {
+	numItemsPerParallelDB := int64(math.Ceil(float64(params.NumItems / params.NParallelism)))
+	return int(elemIndex / numItemsPerParallelDB), elemIndex % numItemsPerParallelDB
+}
+
+// MaxItemBytes returns the size of the largest item that fits in
+// a single plaintext (i.e., that InitParams does not split into chunks)
+func MaxItemBytes(polyDegree, logt int) int {
+	return polyDegree * logt / 8
+}
+
+// SealPIR uses a single 60-bit coefficient modulus (see gen_params in SealPIR/pir.cpp)
+// so each ciphertext is a pair of polynomials with one 64-bit word per coefficient
+const ciphertextModulusBits = 60
+
+// CiphertextBytes returns the (approximate) size of a serialized ciphertext
+func CiphertextBytes(polyDegree int) int {
+	return 2 * polyDegree * 8
+}
+
+// QueryBytes returns the (approximate) size of a query: one ciphertext per
+// recursion dimension (for databases with at most polyDegree plaintexts per dimension)
+func QueryBytes(polyDegree, d int) int {
+	return d * CiphertextBytes(polyDegree)
+}
+
+// AnswerBytes returns the (approximate) size of the answer of one parallel database:
+// each recursion level after the first expands every ciphertext into
+// 2*ceil(60/logt) ciphertexts (the expansion ratio in SealPIR/pir.cpp)
+func AnswerBytes(polyDegree, logt, d int) int {
+
+	ratio := 2 * int(math.Ceil(float64(ciphertextModulusBits)/float64(logt)))
+
+	numCiphertexts := 1
+	for i := 1; i < d; i++ {
+		numCiphertexts *= ratio
+	}
+
+	return numCiphertexts * CiphertextBytes(polyDegree)
+}
+
 // SerializeParams returns a serialized version of params
 func SerializeParams(params *Params) *SerializedParams {
 	ser := &SerializedParams{}
@@ -221,3 +321,13 @@ func (server *Server) Free() {
 		C.free_server_wrapper(server.DBs[i])
 	}
 }
+
+// FreeReplaced frees the parallel databases of server that are not shared
+// with updated (i.e., the ones replaced when updated was built by UpdateItems)
+func (server *Server) FreeReplaced(updated *Server) {
+	for i := 0; i < server.Params.NParallelism; i++ {
+		if server.DBs[i] != updated.DBs[i] {
+			C.free_server_wrapper(server.DBs[i])
+		}
+	}
+}
@@ -8,6 +8,7 @@ package sealpir
 // #include "./../C/wrapper.h"
 import "C"
 import (
+	"errors"
 	"math"
 	"sync"
 	"unsafe"
@@ -37,6 +38,12 @@ type GaloisKeysCStruct struct {
 	ClientID C.ulonglong
 }
 
+// DatabaseCStruct must match struct in wrapper.h *exactly*
+type DatabaseCStruct struct {
+	StrPtr *C.char
+	StrLen C.ulonglong
+}
+
 func InitParams(numItems, itemBytes, polyDegree, logt, d, nParallelism int) *Params {
 
 	if numItems <= nParallelism {
@@ -87,6 +94,13 @@ func InitClient(params *Params, clientId int) *Client {
 }
 
 func (server *Server) SetGaloisKeys(keys *GaloisKeys) {
+	for i := 0; i < server.Params.NParallelism; i++ {
+		setGaloisKeys(server.DBs[i], keys)
+	}
+}
+
+// setGaloisKeys sets the keys of a single (parallel) database
+func setGaloisKeys(db unsafe.Pointer, keys *GaloisKeys) {
 
 	galKeysC := GaloisKeysCStruct{
 		StrPtr: C.CString(keys.Str),
@@ -96,9 +110,42 @@ func (server *Server) SetGaloisKeys(keys *GaloisKeys) {
 
 	keysPtr := unsafe.Pointer(&galKeysC)
 
+	C.set_galois_keys(db, keysPtr)
+}
+
+// SerializeDatabase returns the (preprocessed) database of each parallel
+// sub-database such that it can be restored without repeating the preprocessing
+func (server *Server) SerializeDatabase() [][]byte {
+
+	res := make([][]byte, server.Params.NParallelism)
+	for i := 0; i < server.Params.NParallelism; i++ {
+		dbPtr := C.serialize_database(server.DBs[i])
+		dbC := (*DatabaseCStruct)(unsafe.Pointer(dbPtr))
+		res[i] = C.GoBytes(unsafe.Pointer(dbC.StrPtr), C.int(dbC.StrLen))
+		C.free_serialized_database(dbPtr)
+	}
+
+	return res
+}
+
+// LoadDatabase restores each parallel sub-database from its serialization (see SerializeDatabase)
+func (server *Server) LoadDatabase(serialized [][]byte) error {
+
+	if len(serialized) != server.Params.NParallelism {
+		return errors.New("number of serialized databases does not match the parallelism")
+	}
+
 	for i := 0; i < server.Params.NParallelism; i++ {
-		C.set_galois_keys(server.DBs[i], keysPtr)
+		data := C.CBytes(serialized[i])
+		status := C.load_database(server.DBs[i], (*C.char)(data), C.ulonglong(len(serialized[i])))
+		C.free(data)
+
+		if status != 0 {
+			return errors.New("invalid serialized database")
+		}
 	}
+
+	return nil
 }
 
 func (client *Client) GetFVIndex(elemIndex int64) int64 {
@@ -199,5 +246,9 @@ func (client *Client) Recover(answer *Answer, offset int64) []byte {
 
 	res := C.recover(client.Pointer, unsafe.Pointer(&answerC))
 	minSize := 8 * offset * int64(client.Params.ItemBytes)
+	if minSize < (offset+1)*int64(client.Params.ItemBytes) {
+		// make sure the item at offset zero is included
+		minSize = (offset + 1) * int64(client.Params.ItemBytes)
+	}
 	return C.GoBytes(unsafe.Pointer(res), C.int(minSize))
 }
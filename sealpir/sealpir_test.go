@@ -1,6 +1,7 @@
 package sealpir
 
 import (
+	"bytes"
 	"crypto/rand"
 	"math"
 	"math/big"
@@ -153,6 +154,98 @@ func TestFullParallel(t *testing.T) {
 	params.Free()
 }
 
+func TestDatabaseSnapshot(t *testing.T) {
+
+	params := getTestParams()
+	client := InitClient(params, 0)
+
+	keys := client.GenGaloisKeys()
+
+	_, original := InitRandomDB(params)
+
+	var buf bytes.Buffer
+	err := original.WriteSnapshot(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := ReadDatabaseSnapshot(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := db.Server
+	server.SetGaloisKeys(keys)
+
+	elemIndexBig, _ := rand.Int(rand.Reader, big.NewInt(int64(params.NumItems)))
+	elemIndex := elemIndexBig.Int64() % int64(params.NumItems)
+
+	index := client.GetFVIndex(elemIndex)
+	offset := client.GetFVOffset(elemIndex)
+
+	query := client.GenQuery(index)
+	answers := server.GenAnswer(query)
+	res := client.Recover(answers[0], offset)
+
+	itemBytes := int64(params.ItemBytes)
+
+	// check that the restored database answers with the original element
+	for i := int64(0); i < itemBytes; i++ {
+		if res[(offset*itemBytes)+i] != original.Bytes[(elemIndex*itemBytes)+i] {
+			t.Fatalf("restored db elems %d, original db %d\n",
+				res[(offset*itemBytes)+i],
+				original.Bytes[(elemIndex*itemBytes)+i])
+		}
+	}
+
+	client.Free()
+	server.Free()
+	original.Server.Free()
+	params.Free()
+}
+
+func TestUpdateItems(t *testing.T) {
+
+	params := getTestParamsParallel(4)
+	client := InitClient(params, 0)
+
+	keys := client.GenGaloisKeys()
+
+	_, original := InitRandomDB(params)
+	original.Server.SetGaloisKeys(keys)
+
+	elemIndexBig, _ := rand.Int(rand.Reader, big.NewInt(int64(params.NumItems)))
+	elemIndex := elemIndexBig.Int64() % int64(params.NumItems)
+
+	item := make([]byte, params.ItemBytes)
+	rand.Read(item)
+
+	db, err := original.UpdateItems(map[int64][]byte{elemIndex: item}, []*GaloisKeys{keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queryDb, queryIndex := params.ParallelIndex(elemIndex)
+	index := client.GetFVIndex(queryIndex)
+	offset := client.GetFVOffset(queryIndex)
+
+	query := client.GenQuery(index)
+	answers := db.Server.GenAnswer(query)
+	res := client.Recover(answers[queryDb], offset)
+
+	itemBytes := int64(params.ItemBytes)
+
+	// check that we retrieved the updated element
+	for i := int64(0); i < itemBytes; i++ {
+		if res[(offset*itemBytes)+i] != item[i] {
+			t.Fatalf("updated db elems %d, item %d\n", res[(offset*itemBytes)+i], item[i])
+		}
+	}
+
+	client.Free()
+	params.Free()
+}
+
 func BenchmarkParallelQuery(b *testing.B) {
 	// test parameters
 	numItems := 1 << 12
@@ -0,0 +1,84 @@
+package sealpir
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"io"
+)
+
+// DatabaseSnapshotVersion is the version of the database snapshot format.
+// Snapshots with a different version are rejected by Restore.
+const DatabaseSnapshotVersion = 1
+
+// databaseSnapshotMagic identifies a snapshot of a SealPIR database
+var databaseSnapshotMagic = []byte("SEALPIRDB")
+
+// DatabaseSnapshot is a serializable copy of a preprocessed database
+type DatabaseSnapshot struct {
+	Version      int
+	Params       *SerializedParams
+	Bytes        []byte   // raw database bytes
+	Preprocessed [][]byte // preprocessed plaintexts of each parallel sub-database
+}
+
+// Snapshot returns a snapshot of the database (including the preprocessed plaintexts)
+func (db *Database) Snapshot() *DatabaseSnapshot {
+	return &DatabaseSnapshot{
+		Version:      DatabaseSnapshotVersion,
+		Params:       SerializeParams(db.Server.Params),
+		Bytes:        db.Bytes,
+		Preprocessed: db.Server.SerializeDatabase(),
+	}
+}
+
+// Restore returns the database captured by the snapshot
+// without repeating the preprocessing of the database
+func (s *DatabaseSnapshot) Restore() (*Database, error) {
+
+	if s.Version != DatabaseSnapshotVersion {
+		return nil, errors.New("unsupported database snapshot version")
+	}
+
+	server := InitServer(DeserializeParams(s.Params))
+	err := server.LoadDatabase(s.Preprocessed)
+	if err != nil {
+		server.Free()
+		return nil, err
+	}
+
+	return &Database{
+		Server: server,
+		Bytes:  s.Bytes,
+	}, nil
+}
+
+// WriteSnapshot writes a versioned snapshot of the database to w
+func (db *Database) WriteSnapshot(w io.Writer) error {
+
+	if _, err := w.Write(databaseSnapshotMagic); err != nil {
+		return err
+	}
+
+	return gob.NewEncoder(w).Encode(db.Snapshot())
+}
+
+// ReadDatabaseSnapshot reads a database from a snapshot written by WriteSnapshot
+func ReadDatabaseSnapshot(r io.Reader) (*Database, error) {
+
+	magic := make([]byte, len(databaseSnapshotMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(magic, databaseSnapshotMagic) {
+		return nil, errors.New("not a database snapshot")
+	}
+
+	s := &DatabaseSnapshot{}
+	if err := gob.NewDecoder(r).Decode(s); err != nil {
+		return nil, err
+	}
+
+	return s.Restore()
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/sachaservan/adveil/adstore"
+	"github.com/sachaservan/adveil/api"
+	"github.com/sachaservan/adveil/sealpir"
+)
+
+// BuildAdDatabase initializes the SealPIR databases holding the ad creatives.
+// Creatives are split into chunks of AdChunkBytes (see adstore.Directory) and
+// stored in one database per size class, such that a creative of any size is
+// retrieved with the same number of queries to each database.
+// Ads with IDs in [0, NumCategories) (or in KnnIDs) without a creative in
+// serv.AdCreatives get a random creative of AdSizeBytes. If serv.Catalog is set,
+// only the ads in the catalog are stored.
+func BuildAdDatabase(serv *Server) {
+
+	chunkBytes := serv.AdChunkBytes
+	if chunkBytes <= 0 {
+		// largest item that fits in a single plaintext
+		chunkBytes = sealpir.MaxItemBytes(sealpir.DefaultSealPolyDegree, sealpir.DefaultSealLogt)
+	}
+
+	creatives := make(map[int][]byte)
+	for id, creative := range serv.AdCreatives {
+		creatives[id] = creative
+	}
+
+	ids := make([]int, 0, serv.NumCategories+len(serv.KnnIDs))
+	if serv.Catalog != nil {
+		ids = append(ids, serv.Catalog.IDs()...)
+	} else {
+		for id := 0; id < serv.NumCategories; id++ {
+			ids = append(ids, id)
+		}
+		ids = append(ids, serv.KnnIDs...)
+	}
+
+	for _, id := range ids {
+		if _, ok := creatives[id]; !ok {
+			creative := make([]byte, serv.AdSizeBytes)
+			rand.Read(creative)
+			creatives[id] = creative
+		}
+	}
+
+	maxBytes := 0
+	for _, creative := range creatives {
+		if len(creative) > maxBytes {
+			maxBytes = len(creative)
+		}
+	}
+
+	dir, err := adstore.NewDirectory(creatives, chunkBytes, adstore.DefaultSizeClasses(maxBytes, chunkBytes))
+	if err != nil {
+		panic(err)
+	}
+
+	serv.AdDirectory = dir
+	serv.AdDBs = make(map[int]*sealpir.Database)
+	serv.AdParams = make(map[int]*sealpir.Params)
+
+	for class := 0; class < dir.NumClasses(); class++ {
+		data, err := dir.ClassData(creatives, class)
+		if err != nil {
+			panic(err)
+		}
+
+		// round up to a multiple of the parallelism so that
+		// every chunk is addressable in one of the parallel databases
+		numItems := serv.NumProcs * int(math.Ceil(float64(dir.NumItems(class))/float64(serv.NumProcs)))
+		if numItems <= serv.NumProcs {
+			numItems = 2 * serv.NumProcs
+		}
+
+		params := sealpir.InitParams(
+			numItems,
+			chunkBytes,
+			sealpir.DefaultSealPolyDegree,
+			sealpir.DefaultSealLogt,
+			sealpir.DefaultSealRecursionDim,
+			serv.NumProcs,
+		)
+
+		padded := make([]byte, numItems*chunkBytes)
+		copy(padded, data)
+
+		serv.AdParams[class] = params
+		serv.AdDBs[class] = sealpir.InitDB(params, padded)
+	}
+
+	log.Printf("[Server]: stored %v ads in %v size classes (%v chunk queries per ad)\n",
+		len(creatives), dir.NumClasses(), dir.NumQueries())
+}
+
+// PrivateAdQuery performs PIR queries for the chunks of an ad creative.
+// Every request must contain exactly as many queries to each size class
+// as the number of chunks of the size class (see adstore.Directory.QueryPlan).
+func (serv *Server) PrivateAdQuery(args *api.AdQueryArgs, reply *api.AdQueryResponse) error {
+
+	start := time.Now()
+
+	log.Printf("[Server]: received request to PrivateAdQuery\n")
+
+	if serv.AdDirectory == nil {
+		return errors.New("ad database is not built")
+	}
+
+	if len(args.Queries) != serv.AdDirectory.NumClasses() {
+		return errors.New("wrong number of size classes queried")
+	}
+
+	for class, chunks := range serv.AdDirectory.ClassChunks {
+		if len(args.Queries[class]) != chunks {
+			return errors.New("wrong number of queries for a size class")
+		}
+	}
+
+	reply.Answers = make(map[int][][]*sealpir.Answer)
+	for class, queries := range args.Queries {
+		reply.Answers[class] = make([][]*sealpir.Answer, len(queries))
+	}
+
+	var wg sync.WaitGroup
+	for class, queries := range args.Queries {
+		db := serv.AdDBs[class]
+		for i, query := range queries {
+			wg.Add(1)
+			go func(answers [][]*sealpir.Answer, i int, query *sealpir.Query) {
+				defer wg.Done()
+				answers[i] = db.Server.GenAnswer(query)
+			}(reply.Answers[class], i, query)
+		}
+	}
+
+	wg.Wait()
+
+	reply.StatsTotalTimeInMS = time.Since(start).Milliseconds()
+	log.Printf("[Server]: processed PrivateAdQuery request in %v ms", reply.StatsTotalTimeInMS)
+
+	return nil
+}
+
+// AdQuery returns an ad creative in the clear (reveals the ad to the server;
+// used as a baseline for PrivateAdQuery). The index is the ID of the ad.
+func (serv *Server) AdQuery(args *api.AdQueryArgs, reply *api.AdQueryResponse) error {
+
+	start := time.Now()
+
+	if serv.AdDirectory == nil {
+		return errors.New("ad database is not built")
+	}
+
+	loc, ok := serv.AdDirectory.Locations[int(args.Index)]
+	if !ok {
+		return errors.New("ad ID is not in the ad database")
+	}
+
+	creative, err := serv.AdDirectory.ReadCreative(int(args.Index), serv.AdDBs[loc.Class].Bytes)
+	if err != nil {
+		return err
+	}
+
+	reply.Item = creative
+	reply.StatsTotalTimeInMS = time.Since(start).Milliseconds()
+
+	return nil
+}
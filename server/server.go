@@ -1,14 +1,18 @@
 package server
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"math"
 	"net"
 	"sync"
 	"time"
 
+	"github.com/sachaservan/adveil/adstore"
 	"github.com/sachaservan/adveil/anns"
 	"github.com/sachaservan/adveil/api"
+	"github.com/sachaservan/adveil/catalog"
 	"github.com/sachaservan/adveil/ec"
 	"github.com/sachaservan/adveil/sealpir"
 	"github.com/sachaservan/adveil/token"
@@ -16,19 +20,46 @@ import (
 	"github.com/sachaservan/vec"
 )
 
+// Vector commitment proof for dictionary keys (assume keys are 1...n)
+// using bilinear scheme of LY10 requires 48 bytes (@128 bit security)
+// see https://eprint.iacr.org/2020/419.pdf for details.
+const proofBytes = 48
+
 // Server maintains all the necessary state
 type Server struct {
 	Sessions  map[int64]*ClientSession
 	NumProcs  int
+	Catalog   *catalog.Catalog // ads served by the server (see BuildKNNDataStructure)
 	KnnParams *anns.LSHParams
 	KnnValues []*vec.Vec
+	KnnIDs    []int // ad ID of each value (index of the value if nil)
 	Knn       *anns.LSHBasedKNN
 
+	// policy applied to buckets with more than BucketSize values (drop new values if nil)
+	KnnOverflowPolicy anns.OverflowPolicy
+
+	// quantizes the values stored in the table buckets to 1 byte per coordinate
+	KnnQuantizer *anns.Quantizer
+
 	TableDBs    map[int]*sealpir.Database // array of databases; one for each hash table
 	TableParams *sealpir.Params           // array of SealPIR params; one for each hash table
+	NumBuckets  int                       // number of buckets in each hash table (across all partitions)
 
 	NumCategories int
 
+	// SealPIR databases of the ad creatives; one for each size class (see BuildAdDatabase)
+	AdDBs        map[int]*sealpir.Database
+	AdParams     map[int]*sealpir.Params
+	AdDirectory  *adstore.Directory // location of each ad creative in the databases
+	AdChunkBytes int                // bytes per creative chunk (largest single plaintext item if 0)
+	AdSizeBytes  int                // size of the random creative of ads without one
+	AdCreatives  map[int][]byte     // creative of each ad ID (random if missing)
+
+	tableMu    sync.RWMutex                   // guards TableDBs while they are updated (see InsertAd)
+	updateMu   sync.Mutex                     // serializes updates to the targeting data structure
+	galoisKeys map[uint64]*sealpir.GaloisKeys // keys of each client set on the table databases (reapplied on update)
+	adIndices  map[int]int                    // index of each ad ID in KnnValues (built on first update)
+
 	// reporting public/secret keys
 	EC  *ec.EC
 	RPk *token.PublicKey
@@ -58,6 +89,10 @@ func (serv *Server) PrivateBucketQuery(args *api.BucketQueryArgs, reply *api.Buc
 
 	reply.Answers = make(map[int][]*sealpir.Answer)
 
+	// all answers are computed against the same version of the tables
+	serv.tableMu.RLock()
+	defer serv.tableMu.RUnlock()
+
 	var wg sync.WaitGroup
 	var mu sync.Mutex
 	for dbIndex := 0; dbIndex < len(serv.TableDBs); dbIndex++ {
@@ -97,27 +132,34 @@ func (serv *Server) PrivateBucketQuery(args *api.BucketQueryArgs, reply *api.Buc
 	return nil
 }
 
-// buildKNNDataStructure initializes the KNN data structure hash tables
-// and the SealPIR databases used to privately query them
-func BuildKNNDataStructure(serv *Server) {
+// BuildKNNDataStructure initializes the KNN data structure hash tables
+// and the SealPIR databases used to privately query them.
+// If serv.KnnValues is set, the databases are populated with the buckets
+// of the hash tables built over the values. Otherwise, every table is
+// a random database (useful for evaluating worst-case PIR performance).
+// If serv.Catalog is set, the values, ad IDs, and creatives are taken from
+// the catalog and the ad database is built along with the tables.
+// Every bucket (of at least one value) must fit in a single PIR item.
+func BuildKNNDataStructure(serv *Server) (err error) {
+
+	if serv.Catalog != nil {
+		useCatalog(serv)
+		defer func() {
+			if err == nil {
+				BuildAdDatabase(serv)
+			}
+		}()
+	}
 
-	// TODO: build the PIR databases based on the actual hash tables constructed
-	// by the ANNS data structure.
-	//
-	// Currently not implemented for evaluation purposes because it does not result
-	// in worst-case data (for PIR performance) given that the hash tables are likely going to be smaller
-	// (assuming capped bucket sizes) than the case where there is 1 item per bucket and n buckets.
-	//
-	// To evaluate over real hash tables, use the knn.BuildWithData
-	// function which will populate the hash tables.
+	// NOTE: random databases are used by default for evaluation purposes
+	// because they result in worst-case data (for PIR performance) given that
+	// the real hash tables are likely going to be smaller (assuming capped bucket sizes)
+	// than the case where there is 1 item per bucket and n buckets.
 
-	// build a new LSH-based ANN data structure for the values
-	knn, err := anns.NewLSHBased(serv.KnnParams)
-	if err != nil {
-		panic(err)
+	if serv.KnnParams.BucketSize < 1 {
+		return errors.New("bucket size must be at least 1")
 	}
 
-	serv.Knn = knn
 	numTables := serv.KnnParams.NumTables
 	numProbes := serv.KnnParams.NumProbes
 	numBuckets := serv.NumCategories
@@ -134,10 +176,8 @@ func BuildKNNDataStructure(serv *Server) {
 	// contents of bucket
 	bucketBits := vecBits * serv.KnnParams.BucketSize
 
-	// Vector commitment proof for dictionary keys (assume keys are 1...n)
-	// using bilinear scheme of LY10 requires 48 bytes (@128 bit security)
-	// see https://eprint.iacr.org/2020/419.pdf for details.
-	proofBits := (48) * 8
+	// space for the vector commitment proof (see proofBytes)
+	proofBits := proofBytes * 8
 
 	// numProbes
 	// Number of multiprobes to retrieve in each hash table
@@ -151,11 +191,51 @@ func BuildKNNDataStructure(serv *Server) {
 	numTableDBs := numTables * numProbes
 
 	// number of buckets in each partition decreases by the number of multiprobes
-	numBuckets = int(math.Ceil(float64(numBuckets) / float64(numProbes)))
+	// and is rounded up to a multiple of the parallelism so that
+	// every bucket is addressable in one of the parallel databases
+	serv.NumBuckets = anns.PartitionedNumBuckets(numBuckets, numProbes, serv.NumProcs)
+	numBuckets = serv.NumBuckets / numProbes
+
+	// SealPIR requires more items than parallel databases (see BuildAdDatabase)
+	if numBuckets <= serv.NumProcs {
+		numBuckets = 2 * serv.NumProcs
+		serv.NumBuckets = numBuckets * numProbes
+	}
+
+	// LSH digests are compressed to the range of bucket indices
+	serv.KnnParams.NumBuckets = serv.NumBuckets
+
+	// build a new LSH-based ANN data structure for the values
+	knn, err := anns.NewLSHBased(serv.KnnParams)
+	if err != nil {
+		return err
+	}
+
+	knn.OverflowPolicy = serv.KnnOverflowPolicy
+	serv.Knn = knn
 
 	// divide by 8 to convert to bytes
 	bytesPerBucket := (bucketBits + proofBits) / 8
 
+	if serv.KnnValues != nil {
+		// values are quantized to 1 byte per coordinate
+		serv.KnnQuantizer, err = anns.NewQuantizer(serv.KnnValues)
+		if err != nil {
+			return err
+		}
+
+		// serialized bucket contents followed by the space for the proof
+		bytesPerBucket = anns.QuantizedBucketBytes(serv.KnnParams.NumFeatures, serv.KnnParams.BucketSize) + proofBits/8
+	}
+
+	// buckets are retrieved as a single PIR item; larger items
+	// would be split into chunks by SealPIR (see sealpir.InitParams)
+	maxBucketBytes := sealpir.MaxItemBytes(sealpir.DefaultSealPolyDegree, sealpir.DefaultSealLogt)
+	if bytesPerBucket > maxBucketBytes {
+		return fmt.Errorf("buckets of %v bytes exceed the max PIR item size of %v bytes (reduce the bucket size or number of features)",
+			bytesPerBucket, maxBucketBytes)
+	}
+
 	// SealPIR databases and params for each hash table
 	serv.TableDBs = make(map[int]*sealpir.Database)
 
@@ -168,19 +248,118 @@ func BuildKNNDataStructure(serv *Server) {
 		serv.NumProcs,
 	)
 
-	// TODO: this is where actual data would be used
-	_, db := sealpir.InitRandomDB(serv.TableParams)
+	if serv.KnnValues != nil {
+		_, err := knn.BuildWithData(serv.KnnValues, serv.KnnParams.BucketSize)
+		if err != nil {
+			return err
+		}
+
+		stats := knn.OverflowStats()
+		log.Printf("[Server]: %v bucket overflows displaced %v values (%v values in no table)\n",
+			stats.NumOverflows, stats.NumDisplaced, stats.NumMissing)
+
+		for t := 0; t < numTables; t++ {
+			wg.Add(1)
+			go func(t int) {
+				defer wg.Done()
+
+				partitions := tablePartitions(serv, t, numBuckets, bytesPerBucket)
+				for p := 0; p < numProbes; p++ {
+					db := sealpir.InitDB(serv.TableParams, partitions[p])
+
+					mu.Lock()
+					serv.TableDBs[t*numProbes+p] = db
+					mu.Unlock()
+				}
+			}(t)
+		}
+		wg.Wait()
+
+		return nil
+	}
 
+	// every table database is a separate random database
+	// (updates and freeing the databases replace each one independently)
 	for t := 0; t < numTableDBs; t++ {
 		wg.Add(1)
 		go func(t int) {
 			defer wg.Done()
+
+			_, db := sealpir.InitRandomDB(serv.TableParams)
+
 			mu.Lock()
 			serv.TableDBs[t] = db
 			mu.Unlock()
 		}(t)
 	}
 	wg.Wait()
+
+	return nil
+}
+
+// useCatalog sets the values, ad IDs, and creatives from the catalog
+func useCatalog(serv *Server) {
+
+	serv.KnnValues = serv.Catalog.Vectors()
+	serv.KnnIDs = serv.Catalog.IDs()
+	serv.KnnParams.NumFeatures = serv.Catalog.NumFeatures()
+	serv.AdCreatives = serv.Catalog.Creatives()
+	serv.NumCategories = len(serv.Catalog.Ads)
+
+	// keep the ads with the highest bids in full buckets
+	if policy, ok := serv.KnnOverflowPolicy.(*anns.LowestBidPolicy); ok && policy.Bids == nil {
+		policy.Bids = serv.Catalog.Bids()
+	}
+}
+
+// tablePartitions serializes the buckets of the t-th hash table
+// into the database bytes of each of its NumProbes partitions.
+// Bucket i is stored in partition i / partitionSize at index i % partitionSize.
+func tablePartitions(serv *Server, t, partitionSize, bytesPerBucket int) [][]byte {
+
+	numProbes := serv.KnnParams.NumProbes
+
+	partitions := make([][]byte, numProbes)
+	for p := range partitions {
+		partitions[p] = make([]byte, partitionSize*bytesPerBucket)
+	}
+
+	// bucket keys are digests compressed to the range of bucket indices
+	for key, bucket := range serv.Knn.Tables[t].Buckets {
+		index := anns.StringDigestToInt(key).Int64()
+
+		p := int(index) / partitionSize
+		offset := (int(index) % partitionSize) * bytesPerBucket
+		copy(partitions[p][offset:], encodeBucket(serv, bucket))
+	}
+
+	return partitions
+}
+
+// encodeBucket serializes the IDs and (quantized) vectors of the values in a bucket
+func encodeBucket(serv *Server, bucket map[int]bool) []byte {
+
+	ids := make([]int, 0, len(bucket))
+	vectors := make([]*vec.Vec, 0, len(bucket))
+	for i := range bucket {
+		ids = append(ids, adID(serv, i))
+		vectors = append(vectors, serv.KnnValues[i])
+	}
+
+	data, err := anns.EncodeQuantizedBucket(ids, vectors, serv.KnnQuantizer, serv.KnnParams.BucketSize)
+	if err != nil {
+		panic(err)
+	}
+
+	return data
+}
+
+// adID returns the ad ID of the i-th value
+func adID(serv *Server, i int) int {
+	if serv.KnnIDs == nil {
+		return i
+	}
+	return serv.KnnIDs[i]
 }
 
 // for timing purposes only
@@ -193,6 +372,7 @@ func GenFakeReportingToken(serv *Server) (*token.BlindToken, *token.SignedBlindT
 
 	tokenSk := token.SecretKey{
 		EC: serv.EC,
+		Pk: &tokenPk,
 		Sk: serv.RSk.Sk,
 	}
 
@@ -206,5 +386,10 @@ func GenFakeReportingToken(serv *Server) (*token.BlindToken, *token.SignedBlindT
 		panic(err)
 	}
 
+	// the signature must come with a valid proof
+	if _, err := tokenPk.Unblind(W, t); err != nil {
+		panic(err)
+	}
+
 	return t, W
 }
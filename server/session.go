@@ -45,8 +45,51 @@ func (serv *Server) InitSession(args api.InitSessionArgs, reply *api.InitSession
 	reply.NumTables = serv.KnnParams.NumTables
 	reply.NumProbes = serv.KnnParams.NumProbes
 	reply.NumTableDBs = len(serv.TableDBs)
+	reply.Metric = serv.KnnParams.Metric
 	reply.TablePIRParams = sealpir.SerializeParams(serv.TableParams)
-	reply.TableHashFunctions = serv.Knn.Hashes
+
+	// clients derive seeded hash functions from the
+	// params rather than downloading every hash function
+	if serv.KnnParams.Seed != 0 {
+		params := *serv.KnnParams
+		reply.TableHashParams = &params
+	} else {
+		reply.TableHashFunctions = serv.Knn.Hashes
+	}
+
+	reply.TableQuantizer = serv.KnnQuantizer
+
+	if serv.AdDirectory != nil {
+		reply.AdDirectory = serv.AdDirectory
+		reply.AdPIRParams = sealpir.SerializeParamsMap(serv.AdParams)
+	}
+
+	// metadata used by clients to run auctions and enforce frequency caps locally
+	if serv.Catalog != nil {
+		reply.AdBids = make(map[int]float64)
+		reply.AdCampaigns = make(map[int]int)
+		reply.AdCaps = make(map[int]int)
+		reply.CampaignCaps = make(map[int]int)
+
+		for _, ad := range serv.Catalog.Ads {
+			reply.AdBids[ad.ID] = ad.Bid
+			reply.AdCampaigns[ad.ID] = ad.CampaignID
+			if ad.FrequencyCap > 0 {
+				reply.AdCaps[ad.ID] = ad.FrequencyCap
+			}
+		}
+
+		for _, campaign := range serv.Catalog.Campaigns {
+			if campaign.FrequencyCap > 0 {
+				reply.CampaignCaps[campaign.ID] = campaign.FrequencyCap
+			}
+		}
+	}
+
+	reply.TableNumBuckets = make(map[int]int)
+	for i := 0; i < serv.KnnParams.NumTables; i++ {
+		reply.TableNumBuckets[i] = serv.NumBuckets
+	}
 
 	return nil
 }
@@ -55,15 +98,40 @@ func (serv *Server) SetPIRKeys(args api.SetKeysArgs, reply *api.SetKeysResponse)
 
 	log.Printf("[Server]: received request to SetPIRKeys")
 
-	for i := 0; i < serv.KnnParams.NumTables; i++ {
+	// keys are reapplied to table databases that are rebuilt by updates
+	serv.updateMu.Lock()
+	defer serv.updateMu.Unlock()
+
+	serv.tableMu.Lock()
+	defer serv.tableMu.Unlock()
+
+	// keys replace previous keys of the same client (as in SealPIR)
+	if serv.galoisKeys == nil {
+		serv.galoisKeys = make(map[uint64]*sealpir.GaloisKeys)
+	}
+	serv.galoisKeys[args.TableDBGaloisKeys.ClientID] = args.TableDBGaloisKeys
+
+	for i := 0; i < len(serv.TableDBs); i++ {
 		serv.TableDBs[i].Server.SetGaloisKeys(args.TableDBGaloisKeys)
 	}
 
+	for class, keys := range args.AdDBGaloisKeys {
+		if db, ok := serv.AdDBs[class]; ok {
+			db.Server.SetGaloisKeys(keys)
+		}
+	}
+
 	return nil
 }
 
-// TerminateSession kills the server
+// TerminateSession drops the keys of the client and kills the server
 func (serv *Server) TerminateSession(args *api.TerminateSessionArgs, reply *api.TerminateSessionResponse) error {
+
+	// keys are no longer set on table databases rebuilt by updates
+	serv.updateMu.Lock()
+	delete(serv.galoisKeys, args.ClientID)
+	serv.updateMu.Unlock()
+
 	serv.Killed = true
 
 	// serv.AdDb.Server.Free()
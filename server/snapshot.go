@@ -0,0 +1,212 @@
+package server
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"io"
+
+	"github.com/sachaservan/adveil/adstore"
+	"github.com/sachaservan/adveil/anns"
+	"github.com/sachaservan/adveil/sealpir"
+)
+
+// SnapshotVersion is the version of the server snapshot format
+const SnapshotVersion = 2
+
+// snapshotMagic identifies a snapshot of the server targeting state
+var snapshotMagic = []byte("ADVEILSRV")
+
+// snapshot of the targeting data structure and the table databases
+type snapshot struct {
+	Version       int
+	NumCategories int
+	NumBuckets    int
+	KnnIDs        []int
+	KnnQuantizer  *anns.Quantizer
+	Knn           *anns.Snapshot
+	TableDBs      map[int]int // index into DBs of each table database
+	DBs           []*sealpir.DatabaseSnapshot
+	AdDirectory   *adstore.Directory                // layout of the ad creatives (if built)
+	AdDBs         map[int]*sealpir.DatabaseSnapshot // ad creatives of each size class
+}
+
+// WriteSnapshot writes a versioned snapshot of the targeting data structure and the
+// preprocessed table (and ad) databases built by BuildKNNDataStructure (and BuildAdDatabase) to w
+func WriteSnapshot(serv *Server, w io.Writer) error {
+
+	serv.updateMu.Lock()
+	defer serv.updateMu.Unlock()
+
+	if serv.Knn == nil || serv.TableDBs == nil {
+		return errors.New("targeting data structure is not built")
+	}
+
+	s := &snapshot{
+		Version:       SnapshotVersion,
+		NumCategories: serv.NumCategories,
+		NumBuckets:    serv.NumBuckets,
+		KnnIDs:        serv.KnnIDs,
+		KnnQuantizer:  serv.KnnQuantizer,
+		Knn:           serv.Knn.Snapshot(),
+		TableDBs:      make(map[int]int),
+		DBs:           make([]*sealpir.DatabaseSnapshot, 0),
+	}
+
+	// databases shared by several tables are written once
+	indices := make(map[*sealpir.Database]int)
+	for i := 0; i < len(serv.TableDBs); i++ {
+		db := serv.TableDBs[i]
+		index, ok := indices[db]
+		if !ok {
+			index = len(s.DBs)
+			indices[db] = index
+			s.DBs = append(s.DBs, db.Snapshot())
+		}
+		s.TableDBs[i] = index
+	}
+
+	if serv.AdDirectory != nil {
+		s.AdDirectory = serv.AdDirectory
+		s.AdDBs = make(map[int]*sealpir.DatabaseSnapshot)
+		for class, db := range serv.AdDBs {
+			s.AdDBs[class] = db.Snapshot()
+		}
+	}
+
+	if _, err := w.Write(snapshotMagic); err != nil {
+		return err
+	}
+
+	return gob.NewEncoder(w).Encode(s)
+}
+
+// LoadSnapshot restores the targeting data structure and the table databases
+// from a snapshot written by WriteSnapshot (instead of BuildKNNDataStructure).
+// If serv.Catalog is set, the snapshot must hold the ads of the catalog, whose
+// creatives and bids (for the lowest-bid overflow policy) are used as in useCatalog.
+func LoadSnapshot(serv *Server, r io.Reader) error {
+
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(magic, snapshotMagic) {
+		return errors.New("not a server snapshot")
+	}
+
+	s := &snapshot{}
+	if err := gob.NewDecoder(r).Decode(s); err != nil {
+		return err
+	}
+
+	if s.Version != SnapshotVersion {
+		return errors.New("unsupported snapshot version")
+	}
+
+	knn, err := s.Knn.Restore()
+	if err != nil {
+		return err
+	}
+
+	if serv.Catalog != nil {
+		if err := checkSnapshotCatalog(serv, s.KnnIDs, knn); err != nil {
+			return err
+		}
+	}
+
+	dbs := make([]*sealpir.Database, len(s.DBs))
+	for i, dbSnapshot := range s.DBs {
+		dbs[i], err = dbSnapshot.Restore()
+		if err != nil {
+			return err
+		}
+	}
+
+	serv.TableDBs = make(map[int]*sealpir.Database)
+	for i, index := range s.TableDBs {
+		if index < 0 || index >= len(dbs) {
+			return errors.New("snapshot references a missing database")
+		}
+		serv.TableDBs[i] = dbs[index]
+	}
+
+	if len(dbs) > 0 {
+		serv.TableParams = dbs[0].Server.Params
+	}
+
+	if s.AdDirectory != nil {
+		serv.AdDBs = make(map[int]*sealpir.Database)
+		serv.AdParams = make(map[int]*sealpir.Params)
+		for class := 0; class < s.AdDirectory.NumClasses(); class++ {
+			dbSnapshot, ok := s.AdDBs[class]
+			if !ok {
+				return errors.New("snapshot is missing an ad database")
+			}
+
+			db, err := dbSnapshot.Restore()
+			if err != nil {
+				return err
+			}
+			serv.AdDBs[class] = db
+			serv.AdParams[class] = db.Server.Params
+		}
+		serv.AdDirectory = s.AdDirectory
+		serv.AdChunkBytes = s.AdDirectory.ChunkBytes
+	}
+
+	if serv.Catalog != nil {
+		serv.AdCreatives = serv.Catalog.Creatives()
+
+		// bids of the values in the order of the snapshot (see useCatalog)
+		if policy, ok := serv.KnnOverflowPolicy.(*anns.LowestBidPolicy); ok {
+			policy.Bids = make([]float64, len(s.KnnIDs))
+			for i, id := range s.KnnIDs {
+				if ad := serv.Catalog.Ad(id); ad != nil {
+					policy.Bids[i] = ad.Bid
+				}
+			}
+		}
+	}
+
+	knn.OverflowPolicy = serv.KnnOverflowPolicy
+	serv.Knn = knn
+	serv.KnnParams = knn.Params
+	serv.KnnValues = knn.Data
+	serv.KnnIDs = s.KnnIDs
+	serv.KnnQuantizer = s.KnnQuantizer
+	serv.adIndices = nil
+	serv.NumCategories = s.NumCategories
+	serv.NumBuckets = s.NumBuckets
+
+	return nil
+}
+
+// checkSnapshotCatalog returns an error if the ads of the restored tables
+// (excluding deleted ones) are not the ads of the catalog of the server
+func checkSnapshotCatalog(serv *Server, ids []int, knn *anns.LSHBasedKNN) error {
+
+	if len(ids) != len(knn.Data) {
+		return errors.New("snapshot does not identify the ads of the catalog")
+	}
+
+	numAds := 0
+	for i, id := range ids {
+		if knn.Data[i] == nil {
+			// deleted ad
+			continue
+		}
+
+		if serv.Catalog.Ad(id) == nil {
+			return errors.New("snapshot holds ads that are not in the catalog")
+		}
+		numAds++
+	}
+
+	if numAds != len(serv.Catalog.Ads) {
+		return errors.New("catalog holds ads that are not in the snapshot")
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"math/rand"
+
+	"github.com/sachaservan/adveil/anns"
+	"github.com/sachaservan/adveil/sealpir"
+
+	"github.com/sachaservan/vec"
+)
+
+// TableCostModel returns the cost model of privately querying the
+// hash tables built by BuildKNNDataStructure. The cost of each query is its
+// communication (in bytes) at the SealPIR parameters of the table databases:
+// one query and an answer from each of the NumProcs parallel databases.
+func TableCostModel(serv *Server) *anns.PIRCostModel {
+
+	queryBytes := sealpir.QueryBytes(sealpir.DefaultSealPolyDegree, sealpir.DefaultSealRecursionDim)
+	answerBytes := sealpir.AnswerBytes(sealpir.DefaultSealPolyDegree, sealpir.DefaultSealLogt, sealpir.DefaultSealRecursionDim)
+
+	return &anns.PIRCostModel{
+		NumBuckets:          serv.NumCategories,
+		NumPoints:           len(serv.KnnValues),
+		NumParallel:         serv.NumProcs,
+		BucketOverheadBytes: proofBytes,
+		QueryCost:           float64(queryBytes + serv.NumProcs*answerBytes),
+		ByteCost:            1,
+	}
+}
+
+// TuneKNNParams replaces the server's KNN parameters with the cheapest parameters
+// (see TableCostModel) that achieve the target recall@k on a sample of the data.
+// A random sample of sampleSize values is indexed and numQueries other values are
+// used as queries.
+func TuneKNNParams(serv *Server, targetRecall float64, k, sampleSize, numQueries int) error {
+
+	if len(serv.KnnValues) < sampleSize+numQueries {
+		return errors.New("not enough values to sample from for tuning")
+	}
+
+	perm := rand.Perm(len(serv.KnnValues))
+
+	sample := make([]*vec.Vec, sampleSize)
+	for i := range sample {
+		sample[i] = serv.KnnValues[perm[i]]
+	}
+
+	queries := make([]*vec.Vec, numQueries)
+	for i := range queries {
+		queries[i] = serv.KnnValues[perm[sampleSize+i]]
+	}
+
+	res, err := anns.Tune(
+		serv.KnnParams,
+		sample,
+		queries,
+		k,
+		targetRecall,
+		TableCostModel(serv),
+		anns.DefaultTuningSpace(),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[Server]: tuned parameters: tables=%v projections=%v width=%v probes=%v (recall=%.3f, cost=%.0f)\n",
+		res.Params.NumTables,
+		res.Params.NumProjections,
+		res.Params.ProjectionWidth,
+		res.Params.NumProbes,
+		res.Recall,
+		res.Cost,
+	)
+
+	serv.KnnParams = res.Params
+
+	return nil
+}
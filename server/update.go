@@ -0,0 +1,196 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/sachaservan/adveil/anns"
+	"github.com/sachaservan/adveil/sealpir"
+
+	"github.com/sachaservan/vec"
+)
+
+// InsertAd adds an ad with the given ID and targeting vector to the tables
+// and updates the affected buckets in the table databases.
+// Queries are answered against the previous tables until the update completes.
+// The ad must already be in the catalog and the ad databases (if the server has them)
+// since clients could otherwise select an ad whose creative cannot be fetched.
+func InsertAd(serv *Server, id int, v *vec.Vec) error {
+
+	serv.updateMu.Lock()
+	defer serv.updateMu.Unlock()
+
+	if err := checkUpdatable(serv); err != nil {
+		return err
+	}
+
+	if _, ok := adIndex(serv, id); ok {
+		return errors.New("ad ID is already in the tables")
+	}
+
+	if serv.Catalog != nil && serv.Catalog.Ad(id) == nil {
+		return errors.New("ad ID is not in the catalog")
+	}
+
+	if serv.AdDirectory != nil {
+		if _, ok := serv.AdDirectory.Locations[id]; !ok {
+			return errors.New("ad ID is not in the ad databases")
+		}
+	}
+
+	// the ad competes for full buckets with its bid (see useCatalog)
+	if policy, ok := serv.Knn.OverflowPolicy.(*anns.LowestBidPolicy); ok && serv.Catalog != nil {
+		for len(policy.Bids) < len(serv.Knn.Data) {
+			policy.Bids = append(policy.Bids, 0)
+		}
+		policy.Bids = append(policy.Bids[:len(serv.Knn.Data)], serv.Catalog.Ad(id).Bid)
+	}
+
+	index, affected, err := serv.Knn.Insert(v)
+	if err != nil {
+		return err
+	}
+
+	serv.KnnValues = serv.Knn.Data
+	serv.KnnIDs = append(serv.KnnIDs, id)
+	serv.adIndices[id] = index
+
+	return updateTableDBs(serv, affected)
+}
+
+// DeleteAd removes the ad with the given ID from the tables
+// and updates the affected buckets in the table databases
+func DeleteAd(serv *Server, id int) error {
+
+	serv.updateMu.Lock()
+	defer serv.updateMu.Unlock()
+
+	if err := checkUpdatable(serv); err != nil {
+		return err
+	}
+
+	index, ok := adIndex(serv, id)
+	if !ok {
+		return errors.New("ad ID is not in the tables")
+	}
+
+	affected, err := serv.Knn.Delete(index)
+	if err != nil {
+		return err
+	}
+
+	delete(serv.adIndices, id)
+
+	return updateTableDBs(serv, affected)
+}
+
+// UpdateAd replaces the targeting vector of the ad with the given ID
+// and updates the affected buckets in the table databases
+func UpdateAd(serv *Server, id int, v *vec.Vec) error {
+
+	serv.updateMu.Lock()
+	defer serv.updateMu.Unlock()
+
+	if err := checkUpdatable(serv); err != nil {
+		return err
+	}
+
+	index, ok := adIndex(serv, id)
+	if !ok {
+		return errors.New("ad ID is not in the tables")
+	}
+
+	affected, err := serv.Knn.Update(index, v)
+	if err != nil {
+		return err
+	}
+
+	return updateTableDBs(serv, affected)
+}
+
+// checkUpdatable returns an error if the tables were not built from data
+func checkUpdatable(serv *Server) error {
+
+	if serv.Knn == nil || serv.TableDBs == nil {
+		return errors.New("targeting data structure is not built")
+	}
+
+	if serv.KnnValues == nil {
+		return errors.New("updates require tables built from data")
+	}
+
+	if serv.KnnIDs == nil {
+		// values are identified by their index
+		serv.KnnIDs = make([]int, len(serv.KnnValues))
+		for i := range serv.KnnIDs {
+			serv.KnnIDs[i] = i
+		}
+	}
+
+	if serv.adIndices == nil {
+		serv.adIndices = make(map[int]int)
+		for i, id := range serv.KnnIDs {
+			if serv.KnnValues[i] != nil {
+				serv.adIndices[id] = i
+			}
+		}
+	}
+
+	return nil
+}
+
+// adIndex returns the index of the ad with the given ID in KnnValues
+func adIndex(serv *Server, id int) (int, bool) {
+	index, ok := serv.adIndices[id]
+	return index, ok
+}
+
+// updateTableDBs re-encodes the affected buckets of each table and
+// rebuilds (only) the parts of the table databases that hold them.
+// The new databases replace the old ones once all of them are built.
+func updateTableDBs(serv *Server, affected map[int][]string) error {
+
+	numProbes := serv.KnnParams.NumProbes
+	partitionSize := serv.TableParams.NumItems
+
+	// updated items of each table database
+	items := make(map[int]map[int64][]byte)
+	for t, keys := range affected {
+		for _, key := range keys {
+			index := anns.StringDigestToInt(key).Int64()
+			dbIndex := t*numProbes + int(index)/partitionSize
+			if items[dbIndex] == nil {
+				items[dbIndex] = make(map[int64][]byte)
+			}
+
+			bucket := serv.Knn.Tables[t].Buckets[key]
+			items[dbIndex][index%int64(partitionSize)] = encodeBucket(serv, bucket)
+		}
+	}
+
+	// keys of the clients whose sessions have not ended
+	keys := make([]*sealpir.GaloisKeys, 0, len(serv.galoisKeys))
+	for _, k := range serv.galoisKeys {
+		keys = append(keys, k)
+	}
+
+	dbs := make(map[int]*sealpir.Database)
+	for dbIndex, dbItems := range items {
+		db, err := serv.TableDBs[dbIndex].UpdateItems(dbItems, keys)
+		if err != nil {
+			return err
+		}
+		dbs[dbIndex] = db
+	}
+
+	// the replaced parts of the old databases are freed once
+	// no query is answered against them (queries hold tableMu)
+	serv.tableMu.Lock()
+	for dbIndex, db := range dbs {
+		old := serv.TableDBs[dbIndex]
+		serv.TableDBs[dbIndex] = db
+		old.Server.FreeReplaced(db.Server)
+	}
+	serv.tableMu.Unlock()
+
+	return nil
+}
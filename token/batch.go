@@ -0,0 +1,85 @@
+package token
+
+import (
+	"crypto/elliptic"
+	"errors"
+
+	"github.com/sachaservan/adveil/ec"
+)
+
+// SignedBlindTokenBatch is a batch of (blind) signatures
+// with a single proof that they are all signed with the same key
+type SignedBlindTokenBatch struct {
+	Curve elliptic.Curve
+	W     []*ec.Point // (blind) signature of each token
+	Proof *DLEQProof  // batched proof that every W is signed with the secret key of the public key
+}
+
+// NewTokens generates n (blind) tokens
+func (pk *PublicKey) NewTokens(n int) ([]*BlindToken, error) {
+
+	tokens := make([]*BlindToken, n)
+	for i := range tokens {
+		t, err := pk.NewToken()
+		if err != nil {
+			return nil, err
+		}
+		tokens[i] = t
+	}
+
+	return tokens, nil
+}
+
+// SignBatch (computed by the verifier) signs a batch of blinded tokens and
+// proves that all signatures are computed with the secret key of sk.Pk
+// using a single proof over a random linear combination of the tokens
+func (sk *SecretKey) SignBatch(Bs []*ec.Point) (*SignedBlindTokenBatch, error) {
+
+	pk := sk.Pk
+
+	if len(Bs) == 0 {
+		return nil, errors.New("no tokens to sign")
+	}
+
+	Ws := make([]*ec.Point, len(Bs))
+	for i, B := range Bs {
+		if !pk.EC.Curve.IsOnCurve(B.X, B.Y) {
+			return nil, ec.ErrPointOffCurve
+		}
+
+		Ws[i] = pk.EC.ScalarMult(B, sk.Sk) // xB (x = sk)
+	}
+
+	proof, err := proveBatchDLEQ(pk.EC, sk.Sk, pk.Pk, Bs, Ws)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SignedBlindTokenBatch{W: Ws, Proof: proof}, nil
+}
+
+// UnblindBatch (computed by the prover) verifies the batched proof
+// and removes the blinding factors from the signed tokens.
+// Returns ErrInvalidProof if any token is not signed with the secret key of pk.
+func (pk *PublicKey) UnblindBatch(sbtb *SignedBlindTokenBatch, bts []*BlindToken) ([]*SignedToken, error) {
+
+	if len(sbtb.W) != len(bts) {
+		return nil, errors.New("number of signatures does not match the number of tokens")
+	}
+
+	Bs := make([]*ec.Point, len(bts))
+	for i, bt := range bts {
+		Bs[i] = bt.B
+	}
+
+	if !verifyBatchDLEQ(pk.EC, sbtb.Proof, pk.Pk, Bs, sbtb.W) {
+		return nil, ErrInvalidProof
+	}
+
+	tokens := make([]*SignedToken, len(bts))
+	for i, bt := range bts {
+		tokens[i] = pk.unblind(sbtb.W[i], bt)
+	}
+
+	return tokens, nil
+}
@@ -0,0 +1,173 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"github.com/sachaservan/adveil/ec"
+)
+
+// ErrInvalidProof is returned when a signature does not come with a valid proof
+var ErrInvalidProof = errors.New("invalid proof of signature")
+
+// DLEQProof is a (non-interactive) Chaum-Pedersen proof that
+// log_G(X) = log_B(W), i.e., that the blind signature W = xB was
+// computed with the secret key x of the public key X = xG
+type DLEQProof struct {
+	C *big.Int // challenge
+	S *big.Int // response
+}
+
+// proveDLEQ proves that W = xB and X = xG for the same secret x
+func proveDLEQ(c *ec.EC, x *big.Int, X, B, W *ec.Point) (*DLEQProof, error) {
+
+	N := c.Curve.Params().N
+
+	_, r, err := c.RandomCurveScalar(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	A1 := c.ScalarBaseMult(r) // rG
+	A2 := c.ScalarMult(B, r)  // rB
+
+	challenge := dleqChallenge(c, X, B, W, A1, A2)
+
+	// s = r - cx mod N
+	s := new(big.Int).Mul(challenge, x)
+	s.Sub(r, s)
+	s.Mod(s, N)
+
+	return &DLEQProof{C: challenge, S: s}, nil
+}
+
+// verifyDLEQ checks the proof that W = xB and X = xG for the same secret x
+func verifyDLEQ(c *ec.EC, proof *DLEQProof, X, B, W *ec.Point) bool {
+
+	if proof == nil || proof.C == nil || proof.S == nil {
+		return false
+	}
+
+	N := c.Curve.Params().N
+	if proof.C.Sign() < 0 || proof.C.Cmp(N) >= 0 || proof.S.Sign() < 0 || proof.S.Cmp(N) >= 0 {
+		return false
+	}
+
+	for _, P := range []*ec.Point{X, B, W} {
+		if P == nil || !c.Curve.IsOnCurve(P.X, P.Y) {
+			return false
+		}
+	}
+
+	// A1 = sG + cX = rG and A2 = sB + cW = rB if the proof is valid
+	A1 := c.Add(c.ScalarBaseMult(proof.S), c.ScalarMult(X, proof.C))
+	A2 := c.Add(c.ScalarMult(B, proof.S), c.ScalarMult(W, proof.C))
+
+	return dleqChallenge(c, X, B, W, A1, A2).Cmp(proof.C) == 0
+}
+
+// dleqChallenge hashes the statement and the commitments
+// of the proof (Fiat-Shamir) to a scalar modulo the group order
+func dleqChallenge(c *ec.EC, points ...*ec.Point) *big.Int {
+
+	G, _ := c.GeneratorPoint()
+
+	h := sha256.New()
+	h.Write([]byte("ADVEIL-DLEQ"))
+	for _, P := range append([]*ec.Point{G}, points...) {
+		h.Write(encodePoint(c, P))
+	}
+
+	challenge := new(big.Int).SetBytes(h.Sum(nil))
+	return challenge.Mod(challenge, c.Curve.Params().N)
+}
+
+// proveBatchDLEQ proves that W[i] = xB[i] for all i and X = xG
+// with a single proof over a random linear combination of the points
+func proveBatchDLEQ(c *ec.EC, x *big.Int, X *ec.Point, B, W []*ec.Point) (*DLEQProof, error) {
+
+	coeffs := batchCoefficients(c, X, B, W)
+	M := linearCombination(c, coeffs, B)
+
+	// the signer knows x so Z = sum_i c_i W[i] = xM
+	Z := c.ScalarMult(M, x)
+
+	return proveDLEQ(c, x, X, M, Z)
+}
+
+// verifyBatchDLEQ checks the proof that W[i] = xB[i] for all i and X = xG
+func verifyBatchDLEQ(c *ec.EC, proof *DLEQProof, X *ec.Point, B, W []*ec.Point) bool {
+
+	if len(B) == 0 || len(B) != len(W) {
+		return false
+	}
+
+	for i := range B {
+		if B[i] == nil || W[i] == nil || !c.Curve.IsOnCurve(B[i].X, B[i].Y) || !c.Curve.IsOnCurve(W[i].X, W[i].Y) {
+			return false
+		}
+	}
+
+	coeffs := batchCoefficients(c, X, B, W)
+	M := linearCombination(c, coeffs, B)
+	Z := linearCombination(c, coeffs, W)
+
+	return verifyDLEQ(c, proof, X, M, Z)
+}
+
+// batchCoefficients derives the coefficients c_i of the linear combinations
+// M = sum_i c_i B[i] and Z = sum_i c_i W[i] by hashing all the points (Fiat-Shamir)
+// such that W[i] != xB[i] for some i results in Z != xM with high probability
+func batchCoefficients(c *ec.EC, X *ec.Point, B, W []*ec.Point) []*big.Int {
+
+	h := sha256.New()
+	h.Write([]byte("ADVEIL-DLEQ-BATCH"))
+	h.Write(encodePoint(c, X))
+	for i := range B {
+		h.Write(encodePoint(c, B[i]))
+		h.Write(encodePoint(c, W[i]))
+	}
+	seed := h.Sum(nil)
+
+	coeffs := make([]*big.Int, len(B))
+	for i := range coeffs {
+		// c_i = H(seed, i)
+		index := make([]byte, 8)
+		binary.BigEndian.PutUint64(index, uint64(i))
+
+		ih := sha256.New()
+		ih.Write(seed)
+		ih.Write(index)
+
+		coeffs[i] = new(big.Int).SetBytes(ih.Sum(nil))
+		coeffs[i].Mod(coeffs[i], c.Curve.Params().N)
+	}
+
+	return coeffs
+}
+
+// linearCombination returns sum_i coeffs[i] points[i]
+func linearCombination(c *ec.EC, coeffs []*big.Int, points []*ec.Point) *ec.Point {
+
+	res := c.ScalarMult(points[0], coeffs[0])
+	for i := 1; i < len(points); i++ {
+		res = c.Add(res, c.ScalarMult(points[i], coeffs[i]))
+	}
+
+	return res
+}
+
+// encodePoint returns a fixed-width encoding of the coordinates of P
+func encodePoint(c *ec.EC, P *ec.Point) []byte {
+
+	byteLen := (c.Curve.Params().BitSize + 7) / 8
+
+	buf := make([]byte, 2*byteLen)
+	P.X.FillBytes(buf[:byteLen])
+	P.Y.FillBytes(buf[byteLen:])
+
+	return buf
+}
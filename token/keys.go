@@ -14,9 +14,10 @@ type PublicKey struct {
 }
 
 type SecretKey struct {
-	EC *ec.EC
-	Pk *PublicKey
-	Sk *big.Int
+	EC     *ec.EC
+	Pk     *PublicKey
+	Sk     *big.Int
+	Ledger *Ledger // redeemed tokens (tokens can be redeemed more than once if nil)
 }
 
 func KeyGen(curve elliptic.Curve) (*PublicKey, *SecretKey, error) {
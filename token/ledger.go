@@ -0,0 +1,341 @@
+package token
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"sync"
+)
+
+// ErrTokenSpent is returned when redeeming a token that was already redeemed
+var ErrTokenSpent = errors.New("token was already redeemed")
+
+// size of the digest of a token value stored in the ledger
+const ledgerRecordBytes = sha256.Size
+
+// number of leading bits of a record that select its bucket in the ledger index
+const ledgerIndexBits = 16
+
+// Ledger records the values of redeemed tokens to prevent double spending.
+// Spent tokens are appended to a file (if any) so that they remain spent
+// across restarts. It is safe for concurrent use.
+type Ledger struct {
+	// BatchSync disables syncing the file after each spent token: tokens spent
+	// since the last call to Sync (or Close) may be lost (and spent again) after a
+	// crash, in exchange for a much higher spending rate. Set before use.
+	BatchSync bool
+
+	mu       sync.Mutex
+	spent    map[[ledgerRecordBytes]byte]bool // spent tokens (nil if only stored in the file)
+	filter   *BloomFilter                     // filter of the tokens stored in the file (see OpenLedger)
+	index    *ledgerIndex                     // position of the tokens stored in the file (with filter)
+	file     *os.File                         // append-only log of spent tokens (nil if only in memory)
+	size     int64                            // size of the complete records in the file
+	numSpent int
+	closed   bool
+}
+
+// ledgerIndex locates the records in the ledger file from the first 32 bits of the
+// record (6 bytes per record): the first ledgerIndexBits select a bucket holding the
+// next 16 bits and the position of each record, so that looking up a record only
+// reads the records that share its first 32 bits (typically none or the record itself)
+type ledgerIndex struct {
+	tags      [1 << ledgerIndexBits][]uint16
+	positions [1 << ledgerIndexBits][]uint32 // index of each record in the file
+}
+
+// BloomFilter is a probabilistic set with no false negatives
+type BloomFilter struct {
+	bits []uint64
+	m    uint64 // number of bits
+	k    uint64 // number of hash functions
+}
+
+// NewLedger returns an empty in-memory ledger
+func NewLedger() *Ledger {
+	return &Ledger{
+		spent: make(map[[ledgerRecordBytes]byte]bool),
+	}
+}
+
+// OpenLedger loads the spent tokens from the file at path (creating it if needed)
+// and appends tokens spent from then on to it. A partially written record at the
+// end of the file (e.g., after a crash) is discarded.
+// Each spent token is synced to the file before Spend returns (see BatchSync).
+// If filter is nil, the spent tokens are also kept in memory. Otherwise, they are
+// only stored in the file, in the filter, and in a compact index of their position:
+// tokens that are not in the filter were not spent and only the records of the file
+// located by the index are read for tokens that are (i.e., double spends and false
+// positives of the filter, which should be sized for the expected number of tokens).
+func OpenLedger(path string, filter *BloomFilter) (*Ledger, error) {
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	ledger := &Ledger{filter: filter}
+	if filter == nil {
+		ledger.spent = make(map[[ledgerRecordBytes]byte]bool)
+	} else {
+		ledger.index = &ledgerIndex{}
+	}
+
+	r := bufio.NewReader(f)
+	record := [ledgerRecordBytes]byte{}
+	for {
+		_, err := io.ReadFull(r, record[:])
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		ledger.size += ledgerRecordBytes
+		ledger.insert(record)
+	}
+
+	// drop a partial record (records are written at the end of the complete ones)
+	if err := f.Truncate(ledger.size); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	ledger.file = f
+
+	return ledger, nil
+}
+
+// Spend atomically checks whether the token value t was spent and marks it as spent.
+// Returns false if t was already spent. The token is not marked as spent if it
+// cannot be written (and synced, unless BatchSync is set) to the ledger file.
+func (ledger *Ledger) Spend(t []byte) (bool, error) {
+
+	record := sha256.Sum256(t)
+
+	ledger.mu.Lock()
+	defer ledger.mu.Unlock()
+
+	spent, err := ledger.contains(record)
+	if err != nil || spent {
+		return false, err
+	}
+
+	if ledger.file != nil {
+		if err := ledger.append(record); err != nil {
+			return false, err
+		}
+	}
+
+	ledger.insert(record)
+
+	return true, nil
+}
+
+// IsSpent returns true if the token value t was spent
+func (ledger *Ledger) IsSpent(t []byte) (bool, error) {
+
+	record := sha256.Sum256(t)
+
+	ledger.mu.Lock()
+	defer ledger.mu.Unlock()
+
+	return ledger.contains(record)
+}
+
+// NumSpent returns the number of spent tokens
+func (ledger *Ledger) NumSpent() int {
+
+	ledger.mu.Lock()
+	defer ledger.mu.Unlock()
+
+	return ledger.numSpent
+}
+
+// Sync commits the ledger file to stable storage
+func (ledger *Ledger) Sync() error {
+
+	ledger.mu.Lock()
+	defer ledger.mu.Unlock()
+
+	if ledger.file == nil {
+		return nil
+	}
+
+	return ledger.file.Sync()
+}
+
+// Close syncs and closes the ledger file.
+// Tokens cannot be spent or looked up once the ledger is closed.
+func (ledger *Ledger) Close() error {
+
+	ledger.mu.Lock()
+	defer ledger.mu.Unlock()
+
+	ledger.closed = true
+	if ledger.file == nil {
+		return nil
+	}
+
+	err := ledger.file.Sync()
+	if closeErr := ledger.file.Close(); err == nil {
+		err = closeErr
+	}
+	ledger.file = nil
+
+	return err
+}
+
+func (ledger *Ledger) contains(record [ledgerRecordBytes]byte) (bool, error) {
+
+	if ledger.closed {
+		return false, errors.New("ledger is closed")
+	}
+
+	if ledger.spent != nil {
+		return ledger.spent[record], nil
+	}
+
+	// tokens that are not in the filter were definitely not spent
+	if !ledger.filter.Contains(record[:]) {
+		return false, nil
+	}
+
+	return ledger.lookup(record)
+}
+
+// lookup reads the records of the ledger file located by the index for record
+func (ledger *Ledger) lookup(record [ledgerRecordBytes]byte) (bool, error) {
+
+	bucket, tag := ledgerIndexKey(record)
+
+	buf := make([]byte, ledgerRecordBytes)
+	for i, t := range ledger.index.tags[bucket] {
+		if t != tag {
+			continue
+		}
+
+		offset := int64(ledger.index.positions[bucket][i]) * ledgerRecordBytes
+		if _, err := ledger.file.ReadAt(buf, offset); err != nil {
+			return false, err
+		}
+
+		if bytes.Equal(buf, record[:]) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// append writes record after the last complete record of the ledger file
+// and syncs the file (unless BatchSync is set).
+// A failed (or short) write is truncated back to the last complete record;
+// if that fails too, the partial record is overwritten by the next append.
+func (ledger *Ledger) append(record [ledgerRecordBytes]byte) error {
+
+	n, err := ledger.file.WriteAt(record[:], ledger.size)
+	if err == nil && n < ledgerRecordBytes {
+		err = io.ErrShortWrite
+	}
+
+	if err == nil && !ledger.BatchSync {
+		err = ledger.file.Sync()
+	}
+
+	if err != nil {
+		ledger.file.Truncate(ledger.size)
+		return err
+	}
+
+	ledger.size += ledgerRecordBytes
+
+	return nil
+}
+
+// insert marks record as spent; records stored in the file must be
+// inserted once they are the last complete record of the file
+func (ledger *Ledger) insert(record [ledgerRecordBytes]byte) {
+
+	if ledger.spent != nil {
+		ledger.spent[record] = true
+	} else {
+		ledger.filter.Add(record[:])
+
+		bucket, tag := ledgerIndexKey(record)
+		position := uint32(ledger.size/ledgerRecordBytes - 1)
+		ledger.index.tags[bucket] = append(ledger.index.tags[bucket], tag)
+		ledger.index.positions[bucket] = append(ledger.index.positions[bucket], position)
+	}
+
+	ledger.numSpent++
+}
+
+// ledgerIndexKey returns the bucket of record in the ledger index
+// and the tag that identifies it (with high probability) in the bucket
+func ledgerIndexKey(record [ledgerRecordBytes]byte) (int, uint16) {
+	prefix := binary.BigEndian.Uint32(record[:4])
+	return int(prefix >> (32 - ledgerIndexBits)), uint16(prefix)
+}
+
+// NewBloomFilter returns a Bloom filter sized for n elements
+// with a false positive rate of (approximately) fpRate
+func NewBloomFilter(n int, fpRate float64) *BloomFilter {
+
+	if n < 1 {
+		n = 1
+	}
+
+	// optimal number of bits and hash functions
+	m := uint64(math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+
+	return &BloomFilter{
+		bits: make([]uint64, (m+63)/64),
+		m:    m,
+		k:    k,
+	}
+}
+
+// Add inserts data into the filter
+func (bf *BloomFilter) Add(data []byte) {
+	h1, h2 := bloomHashes(data)
+	for i := uint64(0); i < bf.k; i++ {
+		bit := (h1 + i*h2) % bf.m
+		bf.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// Contains returns false if data was definitely not added to the filter
+func (bf *BloomFilter) Contains(data []byte) bool {
+	h1, h2 := bloomHashes(data)
+	for i := uint64(0); i < bf.k; i++ {
+		bit := (h1 + i*h2) % bf.m
+		if bf.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bloomHashes derives the two hashes used for double hashing
+// (see Kirsch and Mitzenmacher. Less Hashing, Same Performance)
+func bloomHashes(data []byte) (uint64, uint64) {
+	digest := sha256.Sum256(data)
+	h1 := binary.BigEndian.Uint64(digest[:8])
+	h2 := binary.BigEndian.Uint64(digest[8:16]) | 1 // odd so that all k bits differ
+	return h1, h2
+}
@@ -0,0 +1,297 @@
+package token
+
+import (
+	"crypto/elliptic"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func getTestSignedTokens(t *testing.T, sk *SecretKey, n int) []*SignedToken {
+
+	pk := sk.Pk
+
+	bts, err := pk.NewTokens(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens := make([]*SignedToken, n)
+	for i, bt := range bts {
+		sbt, err := sk.Sign(bt.B)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tokens[i], err = pk.Unblind(sbt, bt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return tokens
+}
+
+func TestRedeemOnce(t *testing.T) {
+
+	curve := elliptic.P256()
+	_, sk, _ := KeyGen(curve)
+	sk.Ledger = NewLedger()
+
+	T := getTestSignedTokens(t, sk, 1)[0]
+
+	valid, err := sk.Redeem(T)
+	if err != nil || !valid {
+		t.Fatalf("failed redemption: %v", err)
+	}
+
+	valid, err = sk.Redeem(T)
+	if err != ErrTokenSpent || valid {
+		t.Fatalf("expected a double spend to fail, got %v", err)
+	}
+}
+
+func TestConcurrentRedeem(t *testing.T) {
+
+	curve := elliptic.P256()
+	_, sk, _ := KeyGen(curve)
+	sk.Ledger = NewLedger()
+
+	tokens := getTestSignedTokens(t, sk, 10)
+
+	numRedeemers := 16
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	redeemed := make(map[int]int)
+	for r := 0; r < numRedeemers; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// every goroutine tries to redeem every token
+			for i, T := range tokens {
+				valid, err := sk.Redeem(T)
+				if err != nil && err != ErrTokenSpent {
+					t.Error(err)
+					return
+				}
+
+				if valid {
+					mu.Lock()
+					redeemed[i]++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := range tokens {
+		if redeemed[i] != 1 {
+			t.Fatalf("token %v was redeemed %v times", i, redeemed[i])
+		}
+	}
+}
+
+func TestLedgerPersistence(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "ledger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "spent.log")
+
+	ledger, err := OpenLedger(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		fresh, err := ledger.Spend([]byte(fmt.Sprintf("token %v", i)))
+		if err != nil || !fresh {
+			t.Fatalf("failed to spend token %v: %v", i, err)
+		}
+	}
+
+	if err := ledger.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// simulate a partially written record
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{1, 2, 3})
+	f.Close()
+
+	ledger, err = OpenLedger(path, NewBloomFilter(100, 0.01))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ledger.Close()
+
+	if ledger.NumSpent() != 10 {
+		t.Fatalf("expected 10 spent tokens, got %v", ledger.NumSpent())
+	}
+
+	if ledger.spent != nil {
+		t.Fatalf("ledger with a filter keeps the spent tokens in memory")
+	}
+
+	for i := 0; i < 10; i++ {
+		spent, err := ledger.IsSpent([]byte(fmt.Sprintf("token %v", i)))
+		if err != nil || !spent {
+			t.Fatalf("token %v is not spent after reopening the ledger: %v", i, err)
+		}
+	}
+
+	fresh, err := ledger.Spend([]byte("token 10"))
+	if err != nil || !fresh {
+		t.Fatalf("failed to spend a new token: %v", err)
+	}
+
+	fresh, err = ledger.Spend([]byte("token 3"))
+	if err != nil || fresh {
+		t.Fatalf("expected a spent token to be rejected")
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Size() != 11*ledgerRecordBytes {
+		t.Fatalf("expected %v bytes in the ledger file, got %v", 11*ledgerRecordBytes, info.Size())
+	}
+}
+
+func TestBloomFilter(t *testing.T) {
+
+	n := 1000
+	bf := NewBloomFilter(n, 0.01)
+
+	for i := 0; i < n; i++ {
+		bf.Add([]byte(fmt.Sprintf("in %v", i)))
+	}
+
+	for i := 0; i < n; i++ {
+		if !bf.Contains([]byte(fmt.Sprintf("in %v", i))) {
+			t.Fatalf("false negative for element %v", i)
+		}
+	}
+
+	falsePositives := 0
+	for i := 0; i < n; i++ {
+		if bf.Contains([]byte(fmt.Sprintf("out %v", i))) {
+			falsePositives++
+		}
+	}
+
+	if falsePositives > n/20 {
+		t.Fatalf("too many false positives: %v of %v", falsePositives, n)
+	}
+}
+
+func TestLedgerAppendAfterPartialWrite(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "ledger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "spent.log")
+
+	ledger, err := OpenLedger(path, NewBloomFilter(100, 0.01))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ledger.Close()
+
+	if _, err := ledger.Spend([]byte("token 0")); err != nil {
+		t.Fatal(err)
+	}
+
+	// simulate a failed write that could not be truncated
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{1, 2, 3})
+	f.Close()
+
+	if _, err := ledger.Spend([]byte("token 1")); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Size() != 2*ledgerRecordBytes {
+		t.Fatalf("expected %v bytes in the ledger file, got %v", 2*ledgerRecordBytes, info.Size())
+	}
+
+	for i := 0; i < 2; i++ {
+		spent, err := ledger.IsSpent([]byte(fmt.Sprintf("token %v", i)))
+		if err != nil || !spent {
+			t.Fatalf("token %v is not spent: %v", i, err)
+		}
+	}
+}
+
+func TestLedgerIndex(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "ledger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "spent.log")
+
+	// a small filter lets most lookups through to the index
+	ledger, err := OpenLedger(path, NewBloomFilter(1, 0.5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ledger.Close()
+	ledger.BatchSync = true
+
+	n := 1000
+	for i := 0; i < n; i++ {
+		if _, err := ledger.Spend([]byte(fmt.Sprintf("in %v", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		spent, err := ledger.IsSpent([]byte(fmt.Sprintf("in %v", i)))
+		if err != nil || !spent {
+			t.Fatalf("token %v is not spent: %v", i, err)
+		}
+
+		spent, err = ledger.IsSpent([]byte(fmt.Sprintf("out %v", i)))
+		if err != nil || spent {
+			t.Fatalf("token %v was not spent: %v", i, err)
+		}
+	}
+
+	// a record that shares its indexed bits with a spent record
+	record := sha256.Sum256([]byte("in 0"))
+	record[ledgerRecordBytes-1] ^= 1
+
+	spent, err := ledger.lookup(record)
+	if err != nil || spent {
+		t.Fatalf("record that differs from the spent records is found: %v", err)
+	}
+}
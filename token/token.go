@@ -18,7 +18,8 @@ type BlindToken struct {
 
 type SignedBlindToken struct {
 	Curve elliptic.Curve
-	W     *ec.Point // (blind) signature
+	W     *ec.Point  // (blind) signature
+	Proof *DLEQProof // proof that W is signed with the secret key of the public key
 }
 
 type SignedToken struct {
@@ -77,24 +78,46 @@ func (pk *PublicKey) Blind(P *ec.Point) (*ec.Point, *big.Int, *big.Int) {
 	return B, u, v
 }
 
-// Sign (computed by the verifier) signs a blinded token.
-// The signature is valid or invalid based on the bit b.
+// Sign (computed by the verifier) signs a blinded token and
+// proves that the signature is computed with the secret key of sk.Pk
+// (see DLEQProof) so that clients can check that all tokens are
+// signed with the same key (and cannot be linked by the signer).
 func (sk *SecretKey) Sign(B *ec.Point) (*SignedBlindToken, error) {
 
 	pk := sk.Pk
 
+	if !pk.EC.Curve.IsOnCurve(B.X, B.Y) {
+		return nil, ec.ErrPointOffCurve
+	}
+
 	// use the signing key to sign the token
 	xB := pk.EC.ScalarMult(B, sk.Sk) // xB (x = sk)
 
-	return &SignedBlindToken{W: xB}, nil
+	proof, err := proveDLEQ(pk.EC, sk.Sk, pk.Pk, B, xB)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SignedBlindToken{W: xB, Proof: proof}, nil
 }
 
-// Unblind (computed by the prover) removes the given blinding
-// factor from the signed token.
-func (pk *PublicKey) Unblind(sbt *SignedBlindToken, bt *BlindToken) *SignedToken {
+// Unblind (computed by the prover) verifies the proof of the
+// signed token and removes the given blinding factor from it.
+// Returns ErrInvalidProof if the token is not signed with the secret key of pk.
+func (pk *PublicKey) Unblind(sbt *SignedBlindToken, bt *BlindToken) (*SignedToken, error) {
 
 	W := sbt.W // xB
 
+	if !verifyDLEQ(pk.EC, sbt.Proof, pk.Pk, bt.B, W) {
+		return nil, ErrInvalidProof
+	}
+
+	return pk.unblind(W, bt), nil
+}
+
+// unblind removes the blinding factor from the (verified) signature W = xB
+func (pk *PublicKey) unblind(W *ec.Point, bt *BlindToken) *SignedToken {
+
 	uW := pk.EC.ScalarMult(W, bt.U)     // uW = uxB
 	vX := pk.EC.ScalarMult(pk.Pk, bt.V) // vX = vxG
 
@@ -103,6 +126,9 @@ func (pk *PublicKey) Unblind(sbt *SignedBlindToken, bt *BlindToken) *SignedToken
 	return &SignedToken{T: bt.T, S: S}
 }
 
+// Redeem (computed by the verifier) checks the signature of the token.
+// If sk.Ledger is set, a valid token is atomically marked as spent and
+// redeeming it again returns ErrTokenSpent.
 func (sk *SecretKey) Redeem(T *SignedToken) (bool, error) {
 
 	pk := sk.Pk
@@ -121,5 +147,22 @@ func (sk *SecretKey) Redeem(T *SignedToken) (bool, error) {
 	xP := pk.EC.ScalarMult(P, sk.Sk) // xP
 
 	// are points equal?
-	return xP.X.Cmp(T.S.X) == 0 && xP.Y.Cmp(T.S.Y) == 0, nil
+	if xP.X.Cmp(T.S.X) != 0 || xP.Y.Cmp(T.S.Y) != 0 {
+		return false, nil
+	}
+
+	if sk.Ledger == nil {
+		return true, nil
+	}
+
+	fresh, err := sk.Ledger.Spend(T.T)
+	if err != nil {
+		return false, err
+	}
+
+	if !fresh {
+		return false, ErrTokenSpent
+	}
+
+	return true, nil
 }
@@ -5,9 +5,15 @@ import (
 	"crypto/elliptic"
 	_ "crypto/sha256"
 	"encoding/json"
+	"math/big"
 	"testing"
+
+	"github.com/sachaservan/adveil/ec"
 )
 
+// number of tokens signed in the batch benchmarks
+const benchmarkBatchSize = 32
+
 func TestTokenProtocol(t *testing.T) {
 
 	curve := elliptic.P256()
@@ -22,8 +28,11 @@ func TestTokenProtocol(t *testing.T) {
 	// Server: sign blinded token
 	sbt, _ := sk.Sign(bt.B)
 
-	// Client: unblind signature
-	W := pk.Unblind(sbt, bt)
+	// Client: verify and unblind signature
+	W, err := pk.Unblind(sbt, bt)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	// Server: redeem unblinded token and signature
 	valid, _ := sk.Redeem(W)
@@ -32,6 +41,108 @@ func TestTokenProtocol(t *testing.T) {
 	}
 }
 
+func TestUnblindRejectsOtherKey(t *testing.T) {
+
+	curve := elliptic.P256()
+	pk, _, _ := KeyGen(curve)
+	_, otherSk, _ := KeyGen(curve)
+
+	bt, err := pk.NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// signed (and proven) with a key other than pk
+	sbt, err := otherSk.Sign(bt.B)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := pk.Unblind(sbt, bt); err != ErrInvalidProof {
+		t.Fatalf("expected an invalid proof, got %v", err)
+	}
+}
+
+func TestUnblindRejectsBadProof(t *testing.T) {
+
+	curve := elliptic.P256()
+	pk, sk, _ := KeyGen(curve)
+
+	bt, err := pk.NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sbt, err := sk.Sign(bt.B)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// signature that does not match the proof
+	tampered := &SignedBlindToken{W: pk.EC.Add(sbt.W, pk.EC.ScalarBaseMult(big.NewInt(1))), Proof: sbt.Proof}
+	if _, err := pk.Unblind(tampered, bt); err != ErrInvalidProof {
+		t.Fatalf("expected an invalid proof for a tampered signature, got %v", err)
+	}
+
+	// proof with a modified response
+	proof := &DLEQProof{C: sbt.Proof.C, S: new(big.Int).Add(sbt.Proof.S, big.NewInt(1))}
+	if _, err := pk.Unblind(&SignedBlindToken{W: sbt.W, Proof: proof}, bt); err != ErrInvalidProof {
+		t.Fatalf("expected an invalid proof for a tampered proof, got %v", err)
+	}
+
+	// missing proof
+	if _, err := pk.Unblind(&SignedBlindToken{W: sbt.W}, bt); err != ErrInvalidProof {
+		t.Fatalf("expected an invalid proof for a missing proof, got %v", err)
+	}
+}
+
+func TestBatchTokenProtocol(t *testing.T) {
+
+	curve := elliptic.P256()
+	pk, sk, _ := KeyGen(curve)
+
+	bts, err := pk.NewTokens(16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Bs := make([]*ec.Point, len(bts))
+	for i, bt := range bts {
+		Bs[i] = bt.B
+	}
+
+	sbtb, err := sk.SignBatch(Bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Ws, err := pk.UnblindBatch(sbtb, bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, W := range Ws {
+		valid, _ := sk.Redeem(W)
+		if !valid {
+			t.Fatalf("failed redemption of token %v", i)
+		}
+	}
+
+	// a single signature that is not signed with the key invalidates the batch
+	_, otherSk, _ := KeyGen(curve)
+	sbtb.W[3] = otherSk.Pk.EC.ScalarMult(Bs[3], otherSk.Sk)
+	if _, err := pk.UnblindBatch(sbtb, bts); err != ErrInvalidProof {
+		t.Fatalf("expected an invalid proof, got %v", err)
+	}
+
+	// signatures in the wrong order
+	sbtb, _ = sk.SignBatch(Bs)
+	sbtb.W[0], sbtb.W[1] = sbtb.W[1], sbtb.W[0]
+	if _, err := pk.UnblindBatch(sbtb, bts); err != ErrInvalidProof {
+		t.Fatalf("expected an invalid proof for reordered signatures, got %v", err)
+	}
+}
+
 func BenchmarkGenToken(b *testing.B) {
 
 	curve := elliptic.P256()
@@ -79,6 +190,50 @@ func BenchmarkTokenSign(b *testing.B) {
 
 }
 
+func BenchmarkTokenSignBatch(b *testing.B) {
+
+	curve := elliptic.P256()
+	pk, sk, _ := KeyGen(curve)
+
+	bts, err := pk.NewTokens(benchmarkBatchSize)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	Bs := make([]*ec.Point, len(bts))
+	for i, bt := range bts {
+		Bs[i] = bt.B
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sk.SignBatch(Bs)
+	}
+}
+
+func BenchmarkTokenUnblindBatch(b *testing.B) {
+
+	curve := elliptic.P256()
+	pk, sk, _ := KeyGen(curve)
+
+	bts, err := pk.NewTokens(benchmarkBatchSize)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	Bs := make([]*ec.Point, len(bts))
+	for i, bt := range bts {
+		Bs[i] = bt.B
+	}
+
+	sbtb, _ := sk.SignBatch(Bs)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pk.UnblindBatch(sbtb, bts)
+	}
+}
+
 func BenchmarkTokenRedeem(b *testing.B) {
 
 	curve := elliptic.P256()
@@ -91,7 +246,10 @@ func BenchmarkTokenRedeem(b *testing.B) {
 
 	sbt, _ := sk.Sign(bt.B)
 
-	W := pk.Unblind(sbt, bt)
+	W, err := pk.Unblind(sbt, bt)
+	if err != nil {
+		b.Fatal(err)
+	}
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {